@@ -2,18 +2,83 @@ package client
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	// HTTPHeaderSignature contains the base64 encoded Ed25519 signature of the signed envelope of the response
+	HTTPHeaderSignature = "X-Upgrade-Responder-Signature"
+	// HTTPHeaderSignedAt contains the time the response was signed at in RFC 3339, part of the signed envelope
+	HTTPHeaderSignedAt = "X-Upgrade-Responder-Signed-At"
+	// HTTPHeaderNonce contains the random value of the request, part of the signed envelope
+	HTTPHeaderNonce = "X-Upgrade-Responder-Nonce"
+
+	// DefaultSignatureMaxAge is how far the signing time of a response can be from the client clock
+	DefaultSignatureMaxAge = 15 * time.Minute
+)
+
+// ErrInvalidSignature is returned when the response is not signed by any of the public keys of the UpgradeChecker
+var ErrInvalidSignature = errors.New("invalid upgrade response signature")
+
+// Violation is a value of the request which doesn't satisfy the request schema of a server in strict mode,
+// so it is not stored
+type Violation struct {
+	Key   string      `json:"key"` // e.g. appVersion or extraTagInfo.kubernetesVersion
+	Value interface{} `json:"value"`
+	Rule  string      `json:"rule"` // the schema rule broken, e.g. "pattern ^v[0-9]+", or "unknown key"
+}
+
+// ViolationsError is returned when the server in the strict reject mode rejects the request
+type ViolationsError struct {
+	Message    string      `json:"message"`
+	Violations []Violation `json:"violations"`
+}
+
+func (e *ViolationsError) Error() string {
+	rules := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		rules[i] = fmt.Sprintf("%v: %v", v.Key, v.Rule)
+	}
+	return fmt.Sprintf("%v: %v", e.Message, strings.Join(rules, ", "))
+}
+
 type UpgradeChecker struct {
 	Address                string
 	UpgradeRequester       UpgradeRequester
 	DefaultRequestInterval time.Duration
+	Channel                string              // the release channel to request, the server default is used if empty
+	InstanceID             string              // an anonymous and persistent ID of this instance, used by the server for staged rollout
+	PublicKeys             []ed25519.PublicKey // the responses must be signed by one of these keys if not empty, e.g. the old and the new key during a rotation
+	SignatureMaxAge        time.Duration       // how far the signing time of a response can be from now, DefaultSignatureMaxAge if zero
 	stopCh                 chan struct{}
+
+	// the last response, its body and its ETag, reused when the server responds 304 Not Modified
+	lock         sync.Mutex
+	etag         string
+	lastResponse *CheckUpgradeResponse
+	lastBody     []byte
+}
+
+// signatureEnvelope is what the signature of a response covers, see the server for details
+type signatureEnvelope struct {
+	SignedAt   string `json:"signedAt"`
+	AppVersion string `json:"appVersion"`
+	Nonce      string `json:"nonce"`
+	BodySHA256 string `json:"bodySha256"`
 }
 
 type UpgradeRequester interface {
@@ -28,10 +93,25 @@ type Version struct {
 	MinUpgradableVersion string            `json:"minUpgradableVersion"`
 	Tags                 []string          `json:"tags"`
 	ExtraInfo            map[string]string `json:"extraInfo"`
+	EndOfLifeDate        string            `json:"endOfLifeDate,omitempty"`
+	SupportStatus        string            `json:"supportStatus,omitempty"`
+	Upgradable           bool              `json:"upgradable"` // whether the current version can be upgraded to this version directly
+}
+
+type Advisory struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Summary  string   `json:"summary,omitempty"`
+	Severity string   `json:"severity,omitempty"`
+	Affected string   `json:"affected"`
+	FixedIn  []string `json:"fixedIn,omitempty"`
+	URL      string   `json:"url,omitempty"`
 }
 
 type CheckUpgradeRequest struct {
 	AppVersion string `json:"appVersion"`
+	Channel    string `json:"channel,omitempty"`
+	InstanceID string `json:"instanceId,omitempty"`
 
 	ExtraTagInfo   map[string]string      `json:"extraTagInfo"`
 	ExtraFieldInfo map[string]interface{} `json:"extraFieldInfo"`
@@ -41,8 +121,15 @@ type CheckUpgradeRequest struct {
 }
 
 type CheckUpgradeResponse struct {
-	Versions                 []Version `json:"versions"`
-	RequestIntervalInMinutes int       `json:"requestIntervalInMinutes"`
+	Versions                 []Version   `json:"versions"`
+	RecommendedVersion       string      `json:"recommendedVersion,omitempty"`
+	Urgent                   bool        `json:"urgent,omitempty"`
+	Message                  string      `json:"message,omitempty"`
+	Advisories               []Advisory  `json:"advisories,omitempty"`    // security advisories affecting the current version
+	SupportStatus            string      `json:"supportStatus,omitempty"` // supported, nearing-eol or eol, empty if the current version is unknown to the server
+	UpgradePath              []string    `json:"upgradePath,omitempty"`
+	Violations               []Violation `json:"violations,omitempty"` // values of the request dropped by a server in the strict report mode
+	RequestIntervalInMinutes int         `json:"requestIntervalInMinutes"`
 }
 
 func NewUpgradeChecker(address string, upgradeRequester UpgradeRequester) *UpgradeChecker {
@@ -94,8 +181,98 @@ func (c *UpgradeChecker) SetDefaultRequestInterval(interval time.Duration) {
 	c.DefaultRequestInterval = interval
 }
 
+func (c *UpgradeChecker) SetChannel(channel string) {
+	c.Channel = channel
+}
+
+func (c *UpgradeChecker) SetInstanceID(instanceID string) {
+	c.InstanceID = instanceID
+}
+
+func (c *UpgradeChecker) SetPublicKeys(publicKeys ...ed25519.PublicKey) {
+	c.PublicKeys = publicKeys
+}
+
+func (c *UpgradeChecker) SetSignatureMaxAge(maxAge time.Duration) {
+	c.SignatureMaxAge = maxAge
+}
+
+// ParsePublicKey parses the Ed25519 public key in PKIX PEM format, e.g. generated by
+// `openssl pkey -in signing-key.pem -pubout`
+func ParsePublicKey(pemData []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is %T instead of an Ed25519 key", key)
+	}
+	return publicKey, nil
+}
+
+// newNonce returns a random value binding the signature of the response to the request
+func newNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(nonce), nil
+}
+
+// verifySignature verifies the signature of the response body to the request against the public keys, and that it
+// was signed within the signature max age from now
+func (c *UpgradeChecker) verifySignature(body []byte, header http.Header, appVersion, nonce string, now time.Time) error {
+	signatureHeader := header.Get(HTTPHeaderSignature)
+	if signatureHeader == "" {
+		return fmt.Errorf("%w: no signature in the response", ErrInvalidSignature)
+	}
+	signature, err := base64.StdEncoding.DecodeString(signatureHeader)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	signedAt := header.Get(HTTPHeaderSignedAt)
+	envelope, err := json.Marshal(&signatureEnvelope{
+		SignedAt:   signedAt,
+		AppVersion: appVersion,
+		Nonce:      nonce,
+		BodySHA256: fmt.Sprintf("%x", sha256.Sum256(body)),
+	})
+	if err != nil {
+		return err
+	}
+	verified := false
+	for _, publicKey := range c.PublicKeys {
+		if ed25519.Verify(publicKey, envelope, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return fmt.Errorf("%w: not signed by any pinned public key for this request", ErrInvalidSignature)
+	}
+
+	// The signing time is authenticated by the signature
+	signedTime, err := time.Parse(time.RFC3339, signedAt)
+	if err != nil {
+		return fmt.Errorf("%w: invalid signing time %v", ErrInvalidSignature, signedAt)
+	}
+	maxAge := c.SignatureMaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultSignatureMaxAge
+	}
+	if age := now.Sub(signedTime); age > maxAge || age < -maxAge {
+		return fmt.Errorf("%w: signed at %v, more than %v from now", ErrInvalidSignature, signedAt, maxAge)
+	}
+	return nil
+}
+
 // CheckUpgrade sends a request that contains the current version of the application and any extra information to the Upgrade Responder server.
-// Then it parses and return the response
+// Then it parses and return the response. A *ViolationsError is returned if the server rejects the invalid values of the request.
 func (c *UpgradeChecker) CheckUpgrade(currentAppVersion string, extraInfo map[string]string) (*CheckUpgradeResponse, error) {
 	var (
 		resp    CheckUpgradeResponse
@@ -103,6 +280,8 @@ func (c *UpgradeChecker) CheckUpgrade(currentAppVersion string, extraInfo map[st
 	)
 	req := &CheckUpgradeRequest{
 		AppVersion: currentAppVersion,
+		Channel:    c.Channel,
+		InstanceID: c.InstanceID,
 		ExtraInfo:  extraInfo,
 	}
 
@@ -110,11 +289,47 @@ func (c *UpgradeChecker) CheckUpgrade(currentAppVersion string, extraInfo map[st
 		return nil, err
 	}
 
-	r, err := http.Post(c.Address, "application/json", &content)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	httpReq, err := http.NewRequest(http.MethodPost, c.Address, &content)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.etag != "" {
+		httpReq.Header.Set("If-None-Match", c.etag)
+	}
+	nonce := ""
+	if len(c.PublicKeys) > 0 {
+		if nonce, err = newNonce(); err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set(HTTPHeaderNonce, nonce)
+	}
+
+	r, err := http.DefaultClient.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
 	defer r.Body.Close()
+	if r.StatusCode == http.StatusNotModified && c.lastResponse != nil {
+		// The server signs the body it would have sent, so that a stale response cannot be kept alive by 304
+		if len(c.PublicKeys) > 0 {
+			if err := c.verifySignature(c.lastBody, r.Header, currentAppVersion, nonce, time.Now()); err != nil {
+				return nil, err
+			}
+		}
+		cached := *c.lastResponse
+		return &cached, nil
+	}
+	if r.StatusCode == http.StatusUnprocessableEntity {
+		violationsErr := &ViolationsError{}
+		if err := json.NewDecoder(r.Body).Decode(violationsErr); err != nil {
+			return nil, fmt.Errorf("query return status code %v, fail to decode violations: %v", r.StatusCode, err)
+		}
+		return nil, violationsErr
+	}
 	if r.StatusCode != http.StatusOK {
 		message := ""
 		messageBytes, err := io.ReadAll(r.Body)
@@ -125,9 +340,22 @@ func (c *UpgradeChecker) CheckUpgrade(currentAppVersion string, extraInfo map[st
 		}
 		return nil, fmt.Errorf("query return status code %v, message %v", r.StatusCode, message)
 	}
-	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.PublicKeys) > 0 {
+		if err := c.verifySignature(body, r.Header, currentAppVersion, nonce, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
 		return nil, err
 	}
 
+	c.etag = r.Header.Get("ETag")
+	cached := resp
+	c.lastResponse = &cached
+	c.lastBody = body
 	return &resp, nil
 }
@@ -59,10 +59,13 @@ func (f *MyUpgradeRequester) ProcessUpgradeResponse(resp *client.CheckUpgradeRes
 		}
 	}
 	if latestVersion == "" {
-		logrus.Errorf("cannot find latest version in response: %+v", resp)
+		logrus.Infof("The current version %v is up to date", version)
 	} else {
 		logrus.Infof("The latest version is %v", latestVersion)
 	}
+	if resp.RecommendedVersion != "" {
+		logrus.Infof("The recommended version to upgrade to is %v", resp.RecommendedVersion)
+	}
 }
 
 func registerShutdownChannel(done chan struct{}) {
@@ -3,6 +3,7 @@ module github.com/longhorn/upgrade-responder
 go 1.22
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/Masterminds/semver v1.5.0
 	github.com/Sirupsen/logrus v0.10.0
 	github.com/gorilla/mux v1.8.0
@@ -10,6 +11,7 @@ require (
 	github.com/oschwald/maxminddb-golang v1.8.0
 	github.com/pkg/errors v0.9.1
 	github.com/urfave/cli v1.18.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/sys v0.0.0-20200107162124-548cf772de50 // indirect
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -44,8 +45,61 @@ const (
 	EnvScarfEndpoint                 = "SCARF_ENDPOINT"
 	FlagScarfTimeout                 = "scarf-timeout"
 	EnvScarfTimeout                  = "SCARF_TIMEOUT"
+	FlagConfigReloadInterval         = "config-reload-interval"
+	EnvConfigReloadInterval          = "CONFIG_RELOAD_INTERVAL"
+	FlagAdvisoriesDir                = "advisories-dir"
+	EnvAdvisoriesDir                 = "ADVISORIES_DIR"
+	FlagAdvisoriesPackage            = "advisories-package"
+	EnvAdvisoriesPackage             = "ADVISORIES_PACKAGE"
+	FlagRequests                     = "requests"
+	FlagSigningKey                   = "signing-key"
+	EnvSigningKey                    = "SIGNING_KEY"
+	FlagConfigFormat                 = "config-format"
+	EnvConfigFormat                  = "CONFIG_FORMAT"
+	FlagResponseConfigType           = "response-config-type"
+	EnvResponseConfigType            = "RESPONSE_CONFIG_TYPE"
+	FlagAdminToken                   = "admin-token"
+	EnvAdminTokens                   = "ADMIN_TOKENS"
+	FlagAdminChangeLog               = "admin-change-log"
+	EnvAdminChangeLog                = "ADMIN_CHANGE_LOG"
+	FlagStrictMode                   = "strict-mode"
+	EnvStrictMode                    = "STRICT_MODE"
+	FlagCardinalityWindow            = "cardinality-window"
+	EnvCardinalityWindow             = "CARDINALITY_WINDOW"
+	FlagCardinalityStateFile         = "cardinality-state-file"
+	EnvCardinalityStateFile          = "CARDINALITY_STATE_FILE"
+	FlagReleases                     = "releases"
+	FlagOutput                       = "output"
 )
 
+// The flags of the config files shared by the start, validate and simulate commands
+var (
+	advisoriesDirFlag = cli.StringFlag{
+		Name:   FlagAdvisoriesDir,
+		EnvVar: EnvAdvisoriesDir,
+		Usage:  "Specify the directory of the security advisory files in OSV JSON format. The advisories are added to the ones in the response configuration file",
+	}
+	advisoriesPackageFlag = cli.StringFlag{
+		Name:   FlagAdvisoriesPackage,
+		EnvVar: EnvAdvisoriesPackage,
+		Usage:  "Specify the OSV package name of the application, e.g. github.com/longhorn/longhorn-manager. Only the affected entries of this package in the advisory files are used. Can be empty if each advisory affects a single package",
+	}
+	responseConfigTypeFlag = cli.StringFlag{
+		Name:   FlagResponseConfigType,
+		EnvVar: EnvResponseConfigType,
+		Usage:  "Specify the type of the response configuration. Set to github-releases to build it from a GitHub \"list releases\" JSON document, e.g. https://api.github.com/repos/longhorn/longhorn/releases",
+	}
+)
+
+// configFormatFlag returns the config format flag of a command loading the files
+func configFormatFlag(files string) cli.Flag {
+	return cli.StringFlag{
+		Name:   FlagConfigFormat,
+		EnvVar: EnvConfigFormat,
+		Usage:  fmt.Sprintf("Specify the format of the %v: json, yaml or toml. The format is guessed from the file extension if empty", files),
+	}
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "upgrade-responder"
@@ -66,6 +120,9 @@ func main() {
 
 	app.Commands = []cli.Command{
 		UpgradeResponderCmd(),
+		ValidateCmd(),
+		SimulateCmd(),
+		GitHubReleasesCmd(),
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -80,7 +137,7 @@ func UpgradeResponderCmd() cli.Command {
 			cli.StringFlag{
 				Name:   FlagUpgradeResponseConfiguration,
 				EnvVar: EnvUpgradeResponseConfiguration,
-				Usage:  "Specify the response configuration file for upgrade query",
+				Usage:  "Specify the response configuration file for upgrade query, or the https:// URL to poll it from",
 			},
 			cli.StringFlag{
 				Name:   FlagRequestSchema,
@@ -147,6 +204,47 @@ func UpgradeResponderCmd() cli.Command {
 				Value:  30,
 				Usage:  "Specify the timeout in seconds for Scarf.sh requests",
 			},
+			cli.IntFlag{
+				Name:   FlagConfigReloadInterval,
+				EnvVar: EnvConfigReloadInterval,
+				Value:  30,
+				Usage:  "Specify the period in seconds for how often the server checks the response config and request schema files for changes and reloads them. Set to 0 to disable. The files can also be reloaded by sending SIGHUP to the server",
+			},
+			advisoriesDirFlag,
+			advisoriesPackageFlag,
+			cli.StringFlag{
+				Name:   FlagSigningKey,
+				EnvVar: EnvSigningKey,
+				Usage:  "Specify the Ed25519 private key file in PKCS #8 PEM format used to sign the upgrade responses. The responses are not signed if empty",
+			},
+			configFormatFlag("response configuration and request schema files"),
+			responseConfigTypeFlag,
+			cli.StringSliceFlag{
+				Name:   FlagAdminToken,
+				EnvVar: EnvAdminTokens,
+				Usage:  "Specify an admin API user and its bearer token in the form name:token. Can be repeated, or comma separated in the environment variable. The admin API is disabled if empty",
+			},
+			cli.StringFlag{
+				Name:   FlagAdminChangeLog,
+				EnvVar: EnvAdminChangeLog,
+				Usage:  "Specify the file the changes made through the admin API are appended to. Default to the response configuration file with the .changes.jsonl suffix",
+			},
+			cli.StringFlag{
+				Name:   FlagStrictMode,
+				EnvVar: EnvStrictMode,
+				Usage:  "Specify how the requests violating the request schema are handled: report adds the violations to the response, reject responds 422 with the violations. The invalid values are silently dropped if empty",
+			},
+			cli.StringFlag{
+				Name:   FlagCardinalityWindow,
+				EnvVar: EnvCardinalityWindow,
+				Value:  "24h",
+				Usage:  "Specify the sliding window in which the distinct values of a tag are counted against its maxCardinality in the request schema",
+			},
+			cli.StringFlag{
+				Name:   FlagCardinalityStateFile,
+				EnvVar: EnvCardinalityStateFile,
+				Usage:  "Specify the file the distinct tag values seen in the cardinality window are persisted to, so that restarting the server doesn't reset the cardinality limits. Not persisted if empty",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			return startUpgradeResponder(c)
@@ -154,27 +252,196 @@ func UpgradeResponderCmd() cli.Command {
 	}
 }
 
+func ValidateCmd() cli.Command {
+	return cli.Command{
+		Name:  "validate",
+		Usage: "Validate the response configuration and request schema files without starting the server. Exit with a non-zero code if any problem is found",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   FlagUpgradeResponseConfiguration,
+				EnvVar: EnvUpgradeResponseConfiguration,
+				Usage:  "Specify the response configuration file to validate",
+			},
+			cli.StringFlag{
+				Name:   FlagRequestSchema,
+				EnvVar: EnvRequestSchema,
+				Usage:  "Specify the request schema file to validate",
+			},
+			advisoriesDirFlag,
+			advisoriesPackageFlag,
+			configFormatFlag("response configuration and request schema files"),
+			responseConfigTypeFlag,
+		},
+		Action: func(c *cli.Context) error {
+			return validateConfigFiles(c)
+		},
+	}
+}
+
+// configFilesFromFlags returns the config files set by the flags of the command. The flags the command doesn't have
+// are empty.
+func configFilesFromFlags(c *cli.Context) upgraderesponder.ConfigFiles {
+	return upgraderesponder.ConfigFiles{
+		ResponseConfigFilePath: c.String(FlagUpgradeResponseConfiguration),
+		RequestSchemaFilePath:  c.String(FlagRequestSchema),
+		AdvisoriesDir:          c.String(FlagAdvisoriesDir),
+		AdvisoriesPackage:      c.String(FlagAdvisoriesPackage),
+		ConfigFormat:           c.String(FlagConfigFormat),
+		ResponseConfigType:     c.String(FlagResponseConfigType),
+	}
+}
+
+func validateConfigFiles(c *cli.Context) error {
+	files := configFilesFromFlags(c)
+	if files.ResponseConfigFilePath == "" && files.RequestSchemaFilePath == "" {
+		return fmt.Errorf("no upgrade response configuration file or request schema file specified")
+	}
+	if err := upgraderesponder.ValidateConfigFormat(files.ConfigFormat); err != nil {
+		return err
+	}
+	if err := upgraderesponder.ValidateResponseConfigType(files.ResponseConfigType); err != nil {
+		return err
+	}
+
+	errs := upgraderesponder.ValidateConfigFiles(files)
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("found %v problem(s)", len(errs))
+	}
+	fmt.Println("No problem found")
+	return nil
+}
+
+func SimulateCmd() cli.Command {
+	return cli.Command{
+		Name:  "simulate",
+		Usage: "Print the response each hypothetical client request would receive with the response configuration. No GeoDB nor InfluxDB is needed",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   FlagUpgradeResponseConfiguration,
+				EnvVar: EnvUpgradeResponseConfiguration,
+				Usage:  "Specify the response configuration file to simulate",
+			},
+			advisoriesDirFlag,
+			advisoriesPackageFlag,
+			configFormatFlag("response configuration file"),
+			responseConfigTypeFlag,
+			cli.StringFlag{
+				Name:  FlagRequests,
+				Usage: "Specify the JSON file containing the list of the client requests, e.g. [{\"appVersion\": \"v1.2.0\", \"extraTagInfo\": {\"kubernetesVersion\": \"v1.27.4\"}}]",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return simulate(c)
+		},
+	}
+}
+
+func simulate(c *cli.Context) error {
+	files := configFilesFromFlags(c)
+	if files.ResponseConfigFilePath == "" {
+		return fmt.Errorf("no upgrade response configuration file specified")
+	}
+	requestsFile := c.String(FlagRequests)
+	if requestsFile == "" {
+		return fmt.Errorf("no requests file specified")
+	}
+	if err := upgraderesponder.ValidateConfigFormat(files.ConfigFormat); err != nil {
+		return err
+	}
+	if err := upgraderesponder.ValidateResponseConfigType(files.ResponseConfigType); err != nil {
+		return err
+	}
+
+	server, err := upgraderesponder.NewSimulationServer(files)
+	if err != nil {
+		return err
+	}
+	requests, err := upgraderesponder.LoadSimulationRequests(requestsFile)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(server.Simulate(requests))
+}
+
+func GitHubReleasesCmd() cli.Command {
+	return cli.Command{
+		Name:  "github-releases",
+		Usage: "Convert a GitHub \"list releases\" JSON document into a response configuration. The highest release which is not a prerelease is tagged latest",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  FlagReleases,
+				Usage: "Specify the GitHub releases JSON file, or the https:// URL to download it from, e.g. https://api.github.com/repos/longhorn/longhorn/releases",
+			},
+			cli.StringFlag{
+				Name:  FlagOutput,
+				Usage: "Specify the response configuration file to write. The response configuration is printed if empty",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return convertGitHubReleases(c)
+		},
+	}
+}
+
+func convertGitHubReleases(c *cli.Context) error {
+	releasesFile := c.String(FlagReleases)
+	if releasesFile == "" {
+		return fmt.Errorf("no GitHub releases file specified")
+	}
+
+	config, err := upgraderesponder.LoadGitHubReleases(releasesFile)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append(content, '\n')
+
+	output := c.String(FlagOutput)
+	if output == "" {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	return os.WriteFile(output, content, 0644)
+}
+
 func startUpgradeResponder(c *cli.Context) error {
 	if err := validateCommandLineArguments(c); err != nil {
 		return err
 	}
 
-	responseConfigFile := c.String(FlagUpgradeResponseConfiguration)
-	requestSchemaFile := c.String(FlagRequestSchema)
-	influxURL := c.String(FlagInfluxDBURL)
-	influxUser := c.String(FlagInfluxDBUser)
-	influxPass := c.String(FlagInfluxDBPass)
-	queryPeriod := c.String(FlagQueryPeriod)
-	applicationName := c.String(FlagApplicationName)
-	geodb := c.String(FlagGeoDB)
 	port := c.Int(FlagPort)
-	cacheSyncInterval := c.Int(FlagCacheSyncInterval)
-	cacheSize := c.Int(FlagCacheSize)
-	scarfEndpoint := c.String(FlagScarfEndpoint)
-	scarfTimeout := c.Int(FlagScarfTimeout)
+	opts := upgraderesponder.ServerOptions{
+		ConfigFiles:          configFilesFromFlags(c),
+		ApplicationName:      c.String(FlagApplicationName),
+		InfluxURL:            c.String(FlagInfluxDBURL),
+		InfluxUser:           c.String(FlagInfluxDBUser),
+		InfluxPass:           c.String(FlagInfluxDBPass),
+		QueryPeriod:          c.String(FlagQueryPeriod),
+		GeoDB:                c.String(FlagGeoDB),
+		CacheSyncInterval:    c.Int(FlagCacheSyncInterval),
+		CacheSize:            c.Int(FlagCacheSize),
+		ScarfEndpoint:        c.String(FlagScarfEndpoint),
+		ScarfTimeout:         c.Int(FlagScarfTimeout),
+		ConfigReloadInterval: c.Int(FlagConfigReloadInterval),
+		SigningKeyFile:       c.String(FlagSigningKey),
+		AdminTokens:          c.StringSlice(FlagAdminToken),
+		ChangeLogFilePath:    c.String(FlagAdminChangeLog),
+		StrictMode:           c.String(FlagStrictMode),
+		CardinalityWindow:    c.String(FlagCardinalityWindow),
+		CardinalityStateFile: c.String(FlagCardinalityStateFile),
+	}
 
 	done := make(chan struct{})
-	server, err := upgraderesponder.NewServer(done, applicationName, responseConfigFile, requestSchemaFile, influxURL, influxUser, influxPass, queryPeriod, geodb, cacheSyncInterval, cacheSize, scarfEndpoint, scarfTimeout)
+	server, err := upgraderesponder.NewServer(done, opts)
 	if err != nil {
 		return err
 	}
@@ -192,7 +459,9 @@ func startUpgradeResponder(c *cli.Context) error {
 	}()
 
 	RegisterShutdownChannel(done)
+	RegisterReloadSignal(done, server)
 	<-done
+	server.Wait()
 	return nil
 }
 
@@ -206,6 +475,25 @@ func RegisterShutdownChannel(done chan struct{}) {
 	}()
 }
 
+func RegisterReloadSignal(done chan struct{}, server *upgraderesponder.Server) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				logrus.Infof("Receive %v to reload response config and request schema", sig)
+				if err := server.Reload(); err != nil {
+					logrus.Errorf("Failed to reload, keep using the previous config: %v", err)
+				}
+			case <-done:
+				signal.Stop(sigs)
+				return
+			}
+		}
+	}()
+}
+
 func validateCommandLineArguments(c *cli.Context) error {
 	responseConfigFile := c.String(FlagUpgradeResponseConfiguration)
 	if responseConfigFile == "" {
@@ -227,5 +515,23 @@ func validateCommandLineArguments(c *cli.Context) error {
 		return errors.Wrap(err, "fail to parse --query-period")
 	}
 
+	if err := upgraderesponder.ValidateConfigFormat(c.String(FlagConfigFormat)); err != nil {
+		return err
+	}
+
+	if err := upgraderesponder.ValidateResponseConfigType(c.String(FlagResponseConfigType)); err != nil {
+		return err
+	}
+
+	if err := upgraderesponder.ValidateStrictMode(c.String(FlagStrictMode)); err != nil {
+		return err
+	}
+
+	if cardinalityWindow, err := time.ParseDuration(c.String(FlagCardinalityWindow)); err != nil {
+		return errors.Wrap(err, "fail to parse --cardinality-window")
+	} else if cardinalityWindow <= 0 {
+		return fmt.Errorf("--cardinality-window must be positive")
+	}
+
 	return nil
 }
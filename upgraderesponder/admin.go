@@ -0,0 +1,382 @@
+package upgraderesponder
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/longhorn/upgrade-responder/utils"
+)
+
+const (
+	AdminActionAddVersion    = "add-version"
+	AdminActionUpdateVersion = "update-version"
+	AdminActionDeleteVersion = "delete-version"
+	AdminActionSetLatest     = "set-latest"
+
+	defaultChangeLogSuffix = ".changes.jsonl"
+)
+
+var (
+	ErrVersionNotFound = errors.New("version not found")
+	ErrVersionExists   = errors.New("version already exists")
+)
+
+// ConfigChange is an entry of the change log recording who changed the response config through the admin API
+type ConfigChange struct {
+	Time           string   `json:"time"`
+	User           string   `json:"user"`
+	Action         string   `json:"action"`
+	Version        string   `json:"version,omitempty"`
+	Hash           string   `json:"hash,omitempty"`           // the hash of the config snapshot restored by a rollback
+	Before         *Version `json:"before,omitempty"`         // the version before the change, nil if added
+	After          *Version `json:"after,omitempty"`          // the version after the change, nil if deleted
+	PreviousLatest []string `json:"previousLatest,omitempty"` // the versions tagged latest before the change
+}
+
+// SetLatestRequest is the body of the request to tag a version latest
+type SetLatestRequest struct {
+	Version string `json:"version"`
+}
+
+// parseAdminTokens parses the admin tokens in the form `name:token` into a map of the tokens to the names of
+// their users
+func parseAdminTokens(adminTokens []string) (map[string]string, error) {
+	tokens := map[string]string{}
+	for _, adminToken := range adminTokens {
+		name, token, ok := strings.Cut(adminToken, ":")
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("invalid admin token for %q, must be in the form name:token", name)
+		}
+		if _, exists := tokens[token]; exists {
+			return nil, fmt.Errorf("duplicate admin token for %v", name)
+		}
+		tokens[token] = name
+	}
+	return tokens, nil
+}
+
+// validateAdminConfig returns an error if the response config cannot be changed through the admin API
+func (s *Server) validateAdminConfig() error {
+	if s.remoteResponseConfig != nil {
+		return fmt.Errorf("admin API is not supported with the remote response config %v", s.responseConfigSource())
+	}
+	if s.configFiles.ResponseConfigType != "" {
+		return fmt.Errorf("admin API is not supported with the response config type %v", s.configFiles.ResponseConfigType)
+	}
+	// The TOML encoder cannot keep the comments and the layout of the file it rewrites
+	if configFormatOf(s.configFiles.ResponseConfigFilePath, s.configFiles.ConfigFormat) == ConfigFormatTOML {
+		return fmt.Errorf("admin API is not supported with the TOML response config %v, convert it to YAML or JSON", s.configFiles.ResponseConfigFilePath)
+	}
+	return nil
+}
+
+// authenticateAdmin returns the name of the user whose token is in the Authorization header, or an empty string
+func (s *Server) authenticateAdmin(req *http.Request) string {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	user := ""
+	for t, name := range s.adminTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			user = name
+		}
+	}
+	return user
+}
+
+// adminHandler only calls the handler if the request is authenticated with an admin token
+func (s *Server) adminHandler(handler func(rw http.ResponseWriter, req *http.Request, user string)) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		user := s.authenticateAdmin(req)
+		if user == "" {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(rw, "invalid or missing admin token", http.StatusUnauthorized)
+			return
+		}
+		handler(rw, req, user)
+	}
+}
+
+// respondWithAdminError responds with the HTTP status code matching the error
+func respondWithAdminError(rw http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch errors.Cause(err).(type) {
+	case *ValidationError:
+		code = http.StatusUnprocessableEntity
+	}
+	switch errors.Cause(err) {
+	case ErrAmbiguousHashPrefix:
+		code = http.StatusBadRequest
+	case ErrVersionNotFound, ErrSnapshotNotFound:
+		code = http.StatusNotFound
+	case ErrVersionExists, ErrSnapshotInUse:
+		code = http.StatusConflict
+	}
+	if code == http.StatusInternalServerError {
+		logrus.Errorf("Failed to change response config: %v", err)
+	}
+	http.Error(rw, err.Error(), code)
+}
+
+func (s *Server) AdminListVersions(rw http.ResponseWriter, req *http.Request, user string) {
+	s.RLock()
+	versions := s.versions
+	s.RUnlock()
+
+	if err := respondWithJSON(rw, versions); err != nil {
+		logrus.Errorf("Failed to respondWithJSON: %v", err)
+	}
+}
+
+func (s *Server) AdminAddVersion(rw http.ResponseWriter, req *http.Request, user string) {
+	var version Version
+	if err := json.NewDecoder(req.Body).Decode(&version); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := s.changeResponseConfig(user, AdminActionAddVersion, version.Name, func(config *ResponseConfig, change *ConfigChange) error {
+		if findVersion(config, version.Name) >= 0 {
+			return errors.Wrapf(ErrVersionExists, "%v", version.Name)
+		}
+		config.Versions = append(config.Versions, version)
+		change.After = &version
+		return nil
+	})
+	if err != nil {
+		respondWithAdminError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) AdminUpdateVersion(rw http.ResponseWriter, req *http.Request, user string) {
+	name := mux.Vars(req)["name"]
+	var version Version
+	if err := json.NewDecoder(req.Body).Decode(&version); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if version.Name == "" {
+		version.Name = name
+	}
+
+	err := s.changeResponseConfig(user, AdminActionUpdateVersion, name, func(config *ResponseConfig, change *ConfigChange) error {
+		i := findVersion(config, name)
+		if i < 0 {
+			return errors.Wrapf(ErrVersionNotFound, "%v", name)
+		}
+		if version.Name != name && findVersion(config, version.Name) >= 0 {
+			return errors.Wrapf(ErrVersionExists, "%v", version.Name)
+		}
+		before := config.Versions[i]
+		config.Versions[i] = version
+		change.Before = &before
+		change.After = &version
+		return nil
+	})
+	if err != nil {
+		respondWithAdminError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) AdminDeleteVersion(rw http.ResponseWriter, req *http.Request, user string) {
+	name := mux.Vars(req)["name"]
+
+	err := s.changeResponseConfig(user, AdminActionDeleteVersion, name, func(config *ResponseConfig, change *ConfigChange) error {
+		i := findVersion(config, name)
+		if i < 0 {
+			return errors.Wrapf(ErrVersionNotFound, "%v", name)
+		}
+		before := config.Versions[i]
+		config.Versions = append(config.Versions[:i], config.Versions[i+1:]...)
+		change.Before = &before
+		return nil
+	})
+	if err != nil {
+		respondWithAdminError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// AdminSetLatest moves the latest tag from the versions having it to the version in the request
+func (s *Server) AdminSetLatest(rw http.ResponseWriter, req *http.Request, user string) {
+	var setLatestReq SetLatestRequest
+	if err := json.NewDecoder(req.Body).Decode(&setLatestReq); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := setLatestReq.Version
+
+	err := s.changeResponseConfig(user, AdminActionSetLatest, name, func(config *ResponseConfig, change *ConfigChange) error {
+		i := findVersion(config, name)
+		if i < 0 {
+			return errors.Wrapf(ErrVersionNotFound, "%v", name)
+		}
+		before := config.Versions[i]
+		before.Tags = append([]string{}, before.Tags...)
+		change.Before = &before
+		for j := range config.Versions {
+			v := &config.Versions[j]
+			if !utils.Contains(v.Tags, VersionTagLatest) {
+				continue
+			}
+			change.PreviousLatest = append(change.PreviousLatest, v.Name)
+			tags := []string{}
+			for _, tag := range v.Tags {
+				if tag != VersionTagLatest {
+					tags = append(tags, tag)
+				}
+			}
+			v.Tags = tags
+		}
+		config.Versions[i].Tags = append(config.Versions[i].Tags, VersionTagLatest)
+		after := config.Versions[i]
+		change.After = &after
+		return nil
+	})
+	if err != nil {
+		respondWithAdminError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// findVersion returns the index of the version with the name in the response config, or -1 if not found
+func findVersion(config *ResponseConfig, name string) int {
+	for i := range config.Versions {
+		if config.Versions[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// changeResponseConfig applies the change to the response config file and commits the result.
+// The file is re-read for each change so that the changes made to it directly are not lost.
+func (s *Server) changeResponseConfig(user, action, version string, apply func(config *ResponseConfig, change *ConfigChange) error) error {
+	s.adminLock.Lock()
+	defer s.adminLock.Unlock()
+
+	content, err := os.ReadFile(filepath.Clean(s.configFiles.ResponseConfigFilePath))
+	if err != nil {
+		return errors.Wrapf(err, "fail to open responseConfigFile at %v", s.configFiles.ResponseConfigFilePath)
+	}
+	format := configFormatOf(s.configFiles.ResponseConfigFilePath, s.configFiles.ConfigFormat)
+	config := &ResponseConfig{}
+	if _, err := decodeConfig(content, format, config); err != nil {
+		return errors.Wrapf(err, "fail to decode responseConfigFile at %v", s.configFiles.ResponseConfigFilePath)
+	}
+
+	change := &ConfigChange{
+		Time:    timeNow().UTC().Format(time.RFC3339),
+		User:    user,
+		Action:  action,
+		Version: version,
+	}
+	if err := apply(config, change); err != nil {
+		return err
+	}
+
+	// The YAML file is updated in place to keep the comments of the release team
+	if format == ConfigFormatYAML {
+		content, err = updateYAMLConfig(content, config)
+	} else {
+		content, err = encodeConfig(config, format)
+	}
+	if err != nil {
+		return err
+	}
+	return s.commitResponseConfig(content, change)
+}
+
+// commitResponseConfig validates the content the same way as a reload, writes it to the response config file,
+// records the change in the change log, then loads it. The change log only records the changes written, and the
+// file is restored if the change cannot be recorded. The caller must hold the admin lock.
+func (s *Server) commitResponseConfig(content []byte, change *ConfigChange) error {
+	staging, err := s.stageResponseConfig(content)
+	if err != nil {
+		return err
+	}
+	previous, err := os.ReadFile(filepath.Clean(s.configFiles.ResponseConfigFilePath))
+	if err != nil {
+		return errors.Wrapf(err, "fail to open responseConfigFile at %v", s.configFiles.ResponseConfigFilePath)
+	}
+	if err := writeFileAtomically(s.configFiles.ResponseConfigFilePath, content); err != nil {
+		return err
+	}
+	if err := s.appendConfigChange(change); err != nil {
+		if restoreErr := writeFileAtomically(s.configFiles.ResponseConfigFilePath, previous); restoreErr != nil {
+			logrus.Errorf("Failed to restore response config after failing to record the change: %v", restoreErr)
+		}
+		return err
+	}
+	s.swapResponseConfig(staging)
+
+	logrus.Infof("Response config changed by %v: %v %v%v", change.User, change.Action, change.Version, change.Hash)
+	return nil
+}
+
+// appendConfigChange appends the change to the change log file as a JSON line
+func (s *Server) appendConfigChange(change *ConfigChange) error {
+	line, err := json.Marshal(change)
+	if err != nil {
+		return errors.Wrapf(err, "fail to marshal %v", change)
+	}
+	f, err := os.OpenFile(filepath.Clean(s.changeLogFilePath), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "fail to open change log at %v", s.changeLogFilePath)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return errors.Wrapf(err, "fail to write change log at %v", s.changeLogFilePath)
+	}
+	return f.Sync()
+}
+
+// writeFileAtomically replaces the content of the file by renaming a temporary file written in the same
+// directory, so that the file is never seen partially written
+func writeFileAtomically(path string, content []byte) error {
+	path = filepath.Clean(path)
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return errors.Wrapf(err, "fail to create temporary file for %v", path)
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "fail to write %v", tmpPath)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "fail to sync %v", tmpPath)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "fail to close %v", tmpPath)
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return errors.Wrapf(err, "fail to set the mode of %v", tmpPath)
+	}
+	return errors.Wrapf(os.Rename(tmpPath, path), "fail to replace %v", path)
+}
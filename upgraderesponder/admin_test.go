@@ -0,0 +1,304 @@
+package upgraderesponder
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminAPI(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now, _ := ParseTime("2022-06-15T00:00:00Z")
+	timeNow = func() time.Time { return now }
+
+	dir := t.TempDir()
+	s := &Server{
+		VersionMap:        map[string]*Version{},
+		TagVersionsMap:    map[string][]*Version{},
+		configFiles:       ConfigFiles{ResponseConfigFilePath: filepath.Join(dir, "response.json")},
+		changeLogFilePath: filepath.Join(dir, "response.json"+defaultChangeLogSuffix),
+	}
+	tokens, err := parseAdminTokens([]string{"alice:token-a", "bob:token-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.adminTokens = tokens
+
+	content := `{"versions": [
+		{"name": "v1.0.0", "releaseDate": "2020-05-30T10:20:00Z", "tags": ["latest", "stable"]},
+		{"name": "v0.9.0", "releaseDate": "2020-04-30T10:20:00Z", "tags": ["stable"]}
+	]}`
+	if err := os.WriteFile(s.configFiles.ResponseConfigFilePath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReloadResponseConfig(); err != nil {
+		t.Fatalf("failed to load response config: %v", err)
+	}
+	router := NewRouter(s)
+
+	latest := func() string {
+		s.RLock()
+		defer s.RUnlock()
+		var names []string
+		for _, v := range s.TagVersionsMap[VersionTagLatest] {
+			names = append(names, v.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	testCases := []struct {
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedCode   int
+		expectedLatest string
+	}{
+		{"GET", "/v1/admin/versions", "", "", http.StatusUnauthorized, "v1.0.0"},
+		{"GET", "/v1/admin/versions", "invalid", "", http.StatusUnauthorized, "v1.0.0"},
+		{"GET", "/v1/admin/versions", "token-a", "", http.StatusOK, "v1.0.0"},
+		{"POST", "/v1/admin/versions", "token-a", `{"name": "v1.1.0", "releaseDate": "2020-06-30T10:20:00Z", "tags": ["stable"]}`, http.StatusCreated, "v1.0.0"},
+		{"POST", "/v1/admin/versions", "token-a", `{"name": "v1.1.0", "releaseDate": "2020-06-30T10:20:00Z", "tags": ["stable"]}`, http.StatusConflict, "v1.0.0"},
+		{"POST", "/v1/admin/versions", "token-a", `{"name": "v1.2.0", "releaseDate": "invalid", "tags": ["stable"]}`, http.StatusUnprocessableEntity, "v1.0.0"},
+		{"POST", "/v1/admin/versions", "token-a", `{"name": `, http.StatusBadRequest, "v1.0.0"},
+		{"PUT", "/v1/admin/latest", "token-b", `{"version": "v1.1.0"}`, http.StatusNoContent, "v1.1.0"},
+		{"PUT", "/v1/admin/latest", "token-b", `{"version": "v9.9.9"}`, http.StatusNotFound, "v1.1.0"},
+		{"PUT", "/v1/admin/versions/v1.1.0", "token-a", `{"releaseDate": "2020-07-01T10:20:00Z", "tags": ["stable"]}`, http.StatusUnprocessableEntity, "v1.1.0"},
+		{"PUT", "/v1/admin/versions/v1.1.0", "token-a", `{"releaseDate": "2020-07-01T10:20:00Z", "tags": ["latest", "stable"]}`, http.StatusNoContent, "v1.1.0"},
+		{"PUT", "/v1/admin/versions/v9.9.9", "token-a", `{"releaseDate": "2020-07-01T10:20:00Z", "tags": ["stable"]}`, http.StatusNotFound, "v1.1.0"},
+		{"DELETE", "/v1/admin/versions/v1.1.0", "token-a", "", http.StatusUnprocessableEntity, "v1.1.0"},
+		{"DELETE", "/v1/admin/versions/v0.9.0", "token-a", "", http.StatusNoContent, "v1.1.0"},
+		{"DELETE", "/v1/admin/versions/v0.9.0", "token-a", "", http.StatusNotFound, "v1.1.0"},
+	}
+
+	for i, tc := range testCases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, req)
+		if rw.Code != tc.expectedCode {
+			t.Errorf("Test case %v: %v %v responded %v: %v, expected %v", i, tc.method, tc.path, rw.Code, rw.Body.String(), tc.expectedCode)
+		}
+		if l := latest(); l != tc.expectedLatest {
+			t.Errorf("Test case %v: latest version is %v, expected %v", i, l, tc.expectedLatest)
+		}
+	}
+
+	// The changes are persisted to the response config file
+	reloaded := &Server{configFiles: ConfigFiles{ResponseConfigFilePath: s.configFiles.ResponseConfigFilePath}}
+	if err := reloaded.ReloadResponseConfig(); err != nil {
+		t.Fatalf("failed to reload the changed response config: %v", err)
+	}
+	if reloaded.VersionMap["v1.1.0"] == nil || reloaded.VersionMap["v0.9.0"] != nil {
+		t.Errorf("changes are not persisted: %+v", reloaded.VersionMap)
+	}
+	if tagged := reloaded.TagVersionsMap[VersionTagLatest]; len(tagged) != 1 || tagged[0].Name != "v1.1.0" {
+		t.Errorf("latest tag is not persisted: %+v", tagged)
+	}
+
+	f, err := os.Open(s.changeLogFilePath)
+	if err != nil {
+		t.Fatalf("failed to open change log: %v", err)
+	}
+	defer f.Close()
+	var changes []ConfigChange
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var change ConfigChange
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+			t.Fatalf("invalid change log entry %s: %v", scanner.Bytes(), err)
+		}
+		changes = append(changes, change)
+	}
+	expectedActions := []string{
+		"alice " + AdminActionAddVersion + " v1.1.0",
+		"bob " + AdminActionSetLatest + " v1.1.0",
+		"alice " + AdminActionUpdateVersion + " v1.1.0",
+		"alice " + AdminActionDeleteVersion + " v0.9.0",
+	}
+	if len(changes) != len(expectedActions) {
+		t.Fatalf("change log has %v entries, expected %v: %+v", len(changes), len(expectedActions), changes)
+	}
+	for i, change := range changes {
+		if action := change.User + " " + change.Action + " " + change.Version; action != expectedActions[i] {
+			t.Errorf("change %v is %v, expected %v", i, action, expectedActions[i])
+		}
+		if change.Time != "2022-06-15T00:00:00Z" {
+			t.Errorf("change %v has time %v", i, change.Time)
+		}
+	}
+	if previous := changes[1].PreviousLatest; len(previous) != 1 || previous[0] != "v1.0.0" {
+		t.Errorf("previous latest version of the change is %v, expected v1.0.0", previous)
+	}
+}
+
+func TestParseAdminTokens(t *testing.T) {
+	testCases := []struct {
+		adminTokens []string
+		expectError bool
+	}{
+		{[]string{"alice:token-a", "bob:token:b"}, false},
+		{[]string{"alice"}, true},
+		{[]string{":token"}, true},
+		{[]string{"alice:"}, true},
+		{[]string{"alice:token", "bob:token"}, true},
+	}
+
+	for i, tc := range testCases {
+		_, err := parseAdminTokens(tc.adminTokens)
+		if tc.expectError && err == nil {
+			t.Errorf("Test case %v: expected error for %v", i, tc.adminTokens)
+		} else if !tc.expectError && err != nil {
+			t.Errorf("Test case %v: unexpected error %v", i, err)
+		}
+	}
+}
+
+func TestAdminAPIKeepsYAMLComments(t *testing.T) {
+	dir := t.TempDir()
+	s := &Server{
+		VersionMap:        map[string]*Version{},
+		TagVersionsMap:    map[string][]*Version{},
+		configFiles:       ConfigFiles{ResponseConfigFilePath: filepath.Join(dir, "response.yaml")},
+		changeLogFilePath: filepath.Join(dir, "response.yaml"+defaultChangeLogSuffix),
+		adminTokens:       map[string]string{"token-a": "alice"},
+	}
+	content := `# The response config maintained by the release team
+versions:
+  # Maintenance release for the old Kubernetes versions
+  - name: v1.2.4
+    releaseDate: "2022-03-17T00:00:00Z"
+    tags: [stable] # promoted after the soak test
+  # The current release
+  - name: v1.3.0
+    releaseDate: "2022-06-15T00:00:00Z"
+    tags:
+      - latest
+      - stable
+channels: [stable, latest]
+defaultChannel: stable # most clients stay on stable
+`
+	if err := os.WriteFile(s.configFiles.ResponseConfigFilePath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReloadResponseConfig(); err != nil {
+		t.Fatalf("failed to load response config: %v", err)
+	}
+	router := NewRouter(s)
+
+	for i, tc := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"POST", "/v1/admin/versions", `{"name": "v1.3.1", "releaseDate": "2022-07-15T00:00:00Z", "tags": ["stable"]}`},
+		{"PUT", "/v1/admin/latest", `{"version": "v1.3.1"}`},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Authorization", "Bearer token-a")
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, req)
+		if rw.Code >= 300 {
+			t.Fatalf("Test case %v: %v %v responded %v: %v", i, tc.method, tc.path, rw.Code, rw.Body.String())
+		}
+	}
+
+	updated, err := os.ReadFile(s.configFiles.ResponseConfigFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The comments, the key order and the styles are kept, and the new version is laid out like the others
+	expected := `# The response config maintained by the release team
+versions:
+  # Maintenance release for the old Kubernetes versions
+  - name: v1.2.4
+    releaseDate: "2022-03-17T00:00:00Z"
+    tags: [stable] # promoted after the soak test
+  # The current release
+  - name: v1.3.0
+    releaseDate: "2022-06-15T00:00:00Z"
+    tags:
+      - stable
+  - name: v1.3.1
+    releaseDate: "2022-07-15T00:00:00Z"
+    tags:
+      - stable
+      - latest
+channels: [stable, latest]
+defaultChannel: stable # most clients stay on stable
+`
+	if string(updated) != expected {
+		t.Errorf("response config is changed to\n%s\nexpected\n%s", updated, expected)
+	}
+
+	// The TOML files cannot be changed without losing their comments
+	s.configFiles.ResponseConfigFilePath = filepath.Join(dir, "response.toml")
+	if err := s.validateAdminConfig(); err == nil {
+		t.Errorf("expected error for admin API with TOML response config")
+	}
+}
+
+func TestAdminChangeFailures(t *testing.T) {
+	content := `{"versions": [{"name": "v1.0.0", "releaseDate": "2020-05-30T10:20:00Z", "tags": ["latest"]}]}`
+	addVersion := `{"name": "v1.1.0", "releaseDate": "2020-06-30T10:20:00Z", "tags": ["stable"]}`
+
+	testCases := []struct {
+		description    string
+		configFileName string
+		changeLogIsDir bool
+	}{
+		// The name of the temporary file written next to the config file is too long
+		{description: "config file write failure", configFileName: strings.Repeat("r", 245) + ".json", changeLogIsDir: false},
+		{description: "change log write failure", configFileName: "response.json", changeLogIsDir: true},
+	}
+	for i, tc := range testCases {
+		dir := t.TempDir()
+		s := &Server{
+			VersionMap:        map[string]*Version{},
+			TagVersionsMap:    map[string][]*Version{},
+			configFiles:       ConfigFiles{ResponseConfigFilePath: filepath.Join(dir, tc.configFileName)},
+			changeLogFilePath: filepath.Join(dir, "changes.jsonl"),
+			adminTokens:       map[string]string{"token-a": "alice"},
+		}
+		if err := os.WriteFile(s.configFiles.ResponseConfigFilePath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if tc.changeLogIsDir {
+			if err := os.Mkdir(s.changeLogFilePath, 0700); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.ReloadResponseConfig(); err != nil {
+			t.Fatalf("Test case %v: failed to load response config: %v", i, err)
+		}
+
+		req := httptest.NewRequest("POST", "/v1/admin/versions", strings.NewReader(addVersion))
+		req.Header.Set("Authorization", "Bearer token-a")
+		rw := httptest.NewRecorder()
+		NewRouter(s).ServeHTTP(rw, req)
+		if rw.Code != http.StatusInternalServerError {
+			t.Errorf("Test case %v: %v responded %v: %v, expected %v", i, tc.description, rw.Code, rw.Body.String(), http.StatusInternalServerError)
+		}
+
+		// Neither the file, the change log nor the loaded config has the change
+		if current, err := os.ReadFile(s.configFiles.ResponseConfigFilePath); err != nil || string(current) != content {
+			t.Errorf("Test case %v: response config file is %s after %v: %v", i, current, tc.description, err)
+		}
+		if !tc.changeLogIsDir {
+			if _, err := os.Stat(s.changeLogFilePath); !os.IsNotExist(err) {
+				t.Errorf("Test case %v: change is recorded after %v: %v", i, tc.description, err)
+			}
+		}
+		if s.VersionMap["v1.1.0"] != nil {
+			t.Errorf("Test case %v: change is loaded after %v", i, tc.description)
+		}
+	}
+}
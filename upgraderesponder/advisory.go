@@ -0,0 +1,280 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+// Advisory is a security advisory affecting a range of versions
+type Advisory struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases,omitempty"` // e.g. the CVE IDs
+	Summary  string   `json:"summary,omitempty"`
+	Severity string   `json:"severity,omitempty"`
+	Affected string   `json:"affected"` // semantic version range of the affected versions
+	FixedIn  []string `json:"fixedIn,omitempty"`
+	URL      string   `json:"url,omitempty"`
+
+	affectedRange precedenceRange
+}
+
+func (a *Advisory) validate() error {
+	if a.ID == "" {
+		return fmt.Errorf("invalid empty advisory ID")
+	}
+	r, err := parsePrecedenceRange(a.Affected)
+	if err != nil {
+		return errors.Wrapf(err, "invalid affected range %v of advisory %v", a.Affected, a.ID)
+	}
+	for _, v := range a.FixedIn {
+		if _, err := semver.NewVersion(v); err != nil {
+			return errors.Wrapf(err, "invalid fixed version %v of advisory %v", v, a.ID)
+		}
+	}
+	a.affectedRange = r
+	return nil
+}
+
+// affects returns whether the version is in the affected range. A pre-release is compared by semantic version
+// precedence as in OSV, e.g. 1.2.0-rc1 is affected by ">=1.0.0, <1.2.0" but not by ">=1.2.0".
+func (a *Advisory) affects(v *semver.Version) bool {
+	return a.affectedRange.check(v)
+}
+
+// matchVersionComparison matches a comparison of a range with a full version, e.g. ">=1.2.0" or "<1.3.0-rc1"
+var matchVersionComparison = regexp.MustCompile(`^\s*(>=|<=|!=|>|<|=)?\s*(v?[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?)\s*$`)
+
+// precedenceRange is a semantic version range checked by semantic version precedence, unlike Masterminds/semver
+// which never matches a pre-release with a comparison without pre-release. It is the OR of ANDs of comparisons.
+type precedenceRange [][]versionComparison
+
+// versionComparison is a comparison of a range. The comparisons other than with a full version, e.g. "~1.2" or
+// "1.2.x", are checked by Masterminds/semver against the version without its pre-release.
+type versionComparison struct {
+	op         string
+	version    *semver.Version
+	constraint *semver.Constraints
+}
+
+// parsePrecedenceRange parses a semantic version range with the syntax of parseSemverRange
+func parsePrecedenceRange(r string) (precedenceRange, error) {
+	// The whole range is checked by Masterminds/semver for its syntax errors
+	if _, err := parseSemverRange(r); err != nil {
+		return nil, err
+	}
+	var ors precedenceRange
+	for _, or := range strings.Split(matchRangeConjunction.ReplaceAllString(r, "${1}, ${2}"), "||") {
+		var ands []versionComparison
+		for _, and := range strings.Split(or, ",") {
+			if match := matchVersionComparison.FindStringSubmatch(and); match != nil {
+				version, err := semver.NewVersion(match[2])
+				if err != nil {
+					return nil, err
+				}
+				ands = append(ands, versionComparison{op: match[1], version: version})
+				continue
+			}
+			constraint, err := semver.NewConstraint(and)
+			if err != nil {
+				return nil, err
+			}
+			ands = append(ands, versionComparison{constraint: constraint})
+		}
+		ors = append(ors, ands)
+	}
+	return ors, nil
+}
+
+func (r precedenceRange) check(v *semver.Version) bool {
+	for _, ands := range r {
+		matched := true
+		for _, c := range ands {
+			if !c.check(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (c versionComparison) check(v *semver.Version) bool {
+	if c.constraint != nil {
+		core, err := v.SetPrerelease("")
+		if err != nil {
+			return false
+		}
+		return c.constraint.Check(&core)
+	}
+	result := v.Compare(c.version)
+	switch c.op {
+	case ">=":
+		return result >= 0
+	case "<=":
+		return result <= 0
+	case ">":
+		return result > 0
+	case "<":
+		return result < 0
+	case "!=":
+		return result != 0
+	default:
+		return result == 0
+	}
+}
+
+// osvAdvisory is the subset of the OSV schema (https://ossf.github.io/osv-schema/) used to build an Advisory
+type osvAdvisory struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string              `json:"type"`
+			Events []map[string]string `json:"events"`
+		} `json:"ranges"`
+		Versions []string `json:"versions"`
+	} `json:"affected"`
+	References []struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+	} `json:"references"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// toAdvisory converts the OSV ranges and versions of the package into a semantic version range. The affected entries
+// of the other packages are ignored, and nil is returned if the advisory doesn't affect the package. The package can
+// only be empty if the advisory affects a single package.
+func (o *osvAdvisory) toAdvisory(packageName string) (*Advisory, error) {
+	if packageName == "" {
+		packages := map[string]bool{}
+		for _, affected := range o.Affected {
+			packages[affected.Package.Name] = true
+		}
+		if len(packages) > 1 {
+			return nil, fmt.Errorf("advisory %v affects %v packages, the package of the application must be specified", o.ID, len(packages))
+		}
+	}
+
+	a := &Advisory{
+		ID:       o.ID,
+		Aliases:  o.Aliases,
+		Summary:  o.Summary,
+		Severity: o.DatabaseSpecific.Severity,
+	}
+	if a.Severity == "" && len(o.Severity) > 0 {
+		a.Severity = o.Severity[0].Score
+	}
+	for _, r := range o.References {
+		if a.URL == "" || r.Type == "ADVISORY" {
+			a.URL = r.URL
+		}
+		if r.Type == "ADVISORY" {
+			break
+		}
+	}
+
+	ranges := []string{}
+	matched := false
+	for _, affected := range o.Affected {
+		if packageName != "" && affected.Package.Name != packageName {
+			continue
+		}
+		matched = true
+		for _, r := range affected.Ranges {
+			if r.Type != "SEMVER" && r.Type != "ECOSYSTEM" {
+				continue
+			}
+			// A fixed or last affected event without a preceding introduced event covers the versions from the start
+			introduced := "0.0.0"
+			pending := false
+			for _, event := range r.Events {
+				switch {
+				case event["introduced"] != "":
+					introduced = event["introduced"]
+					if introduced == "0" {
+						introduced = "0.0.0"
+					}
+					pending = true
+				case event["fixed"] != "":
+					ranges = append(ranges, fmt.Sprintf(">=%v, <%v", introduced, event["fixed"]))
+					a.FixedIn = append(a.FixedIn, event["fixed"])
+					introduced, pending = "0.0.0", false
+				case event["last_affected"] != "":
+					ranges = append(ranges, fmt.Sprintf(">=%v, <=%v", introduced, event["last_affected"]))
+					introduced, pending = "0.0.0", false
+				default:
+					return nil, fmt.Errorf("unsupported event %v in advisory %v", event, o.ID)
+				}
+			}
+			if pending {
+				ranges = append(ranges, ">="+introduced)
+			}
+		}
+		for _, v := range affected.Versions {
+			ranges = append(ranges, "="+v)
+		}
+	}
+	if !matched {
+		return nil, nil
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no semantic version range in advisory %v", o.ID)
+	}
+	a.Affected = strings.Join(ranges, " || ")
+	return a, nil
+}
+
+// loadAdvisoriesDir loads the OSV JSON files in the directory, keeping the advisories affecting the package if not
+// empty
+func loadAdvisoriesDir(dir, packageName string) ([]Advisory, error) {
+	files, err := filepath.Glob(filepath.Join(filepath.Clean(dir), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	advisories := []Advisory{}
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to read advisory file %v", file)
+		}
+		var o osvAdvisory
+		if err := json.Unmarshal(content, &o); err != nil {
+			return nil, errors.Wrapf(err, "fail to decode advisory file %v", file)
+		}
+		a, err := o.toAdvisory(packageName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid advisory file %v", file)
+		}
+		if a == nil {
+			logrus.Debugf("Skipped advisory %v in %v not affecting package %v", o.ID, file, packageName)
+			continue
+		}
+		advisories = append(advisories, *a)
+	}
+	return advisories, nil
+}
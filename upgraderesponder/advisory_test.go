@@ -0,0 +1,219 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Masterminds/semver"
+)
+
+func TestLoadAdvisoriesDir(t *testing.T) {
+	advisories, err := loadAdvisoriesDir("testdata/advisories", "")
+	if err != nil {
+		t.Fatalf("failed to load advisories: %v", err)
+	}
+	if len(advisories) != 2 {
+		t.Fatalf("expected 2 advisories but got %v", len(advisories))
+	}
+
+	a := advisories[0]
+	if a.ID != "GHSA-0000-1111-2222" || a.Severity != "CRITICAL" || a.URL != "https://github.com/advisories/GHSA-0000-1111-2222" {
+		t.Errorf("unexpected advisory %+v", a)
+	}
+	if expected := ">=1.2.0, <1.2.6 || >=1.3.0, <1.3.2"; a.Affected != expected {
+		t.Errorf("affected range %v not equal to expected %v", a.Affected, expected)
+	}
+	if !equalStrings(a.FixedIn, []string{"1.2.6", "1.3.2"}) {
+		t.Errorf("unexpected fixed versions %v", a.FixedIn)
+	}
+
+	if expected := ">=0.0.0, <=1.1.3 || =1.2.4"; advisories[1].Affected != expected {
+		t.Errorf("affected range %v not equal to expected %v", advisories[1].Affected, expected)
+	}
+
+	// The second advisory has no affected entry for the package
+	advisories, err = loadAdvisoriesDir("testdata/advisories", "github.com/longhorn/longhorn-manager")
+	if err != nil {
+		t.Fatalf("failed to load advisories: %v", err)
+	}
+	if len(advisories) != 1 || advisories[0].ID != "GHSA-0000-1111-2222" {
+		t.Errorf("unexpected advisories %+v of the package", advisories)
+	}
+}
+
+func TestOSVAdvisoryToAdvisory(t *testing.T) {
+	const manager = `{"ecosystem": "Go", "name": "github.com/longhorn/longhorn-manager"}`
+	const engine = `{"ecosystem": "Go", "name": "github.com/longhorn/longhorn-engine"}`
+
+	testCases := []struct {
+		affected         string
+		packageName      string
+		expectedAffected string
+		expectedSkipped  bool
+		expectedError    bool
+	}{
+		// a fixed or last affected event without a preceding introduced event starts from 0.0.0
+		{
+			affected:         `[{"ranges": [{"type": "SEMVER", "events": [{"fixed": "1.2.6"}]}]}]`,
+			expectedAffected: ">=0.0.0, <1.2.6",
+		},
+		{
+			affected:         `[{"ranges": [{"type": "SEMVER", "events": [{"introduced": "1.2.0"}, {"fixed": "1.2.6"}, {"last_affected": "1.3.1"}]}]}]`,
+			expectedAffected: ">=1.2.0, <1.2.6 || >=0.0.0, <=1.3.1",
+		},
+		{
+			affected:         `[{"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.2.6"}, {"introduced": "1.3.0"}]}]}]`,
+			expectedAffected: ">=0.0.0, <1.2.6 || >=1.3.0",
+		},
+		// only the entries of the package are used
+		{
+			affected: `[{"package": ` + manager + `, "ranges": [{"type": "SEMVER", "events": [{"introduced": "1.2.0"}, {"fixed": "1.2.6"}]}]},
+				{"package": ` + engine + `, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.5.0"}]}]}]`,
+			packageName:      "github.com/longhorn/longhorn-manager",
+			expectedAffected: ">=1.2.0, <1.2.6",
+		},
+		{
+			affected:        `[{"package": ` + engine + `, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.5.0"}]}]}]`,
+			packageName:     "github.com/longhorn/longhorn-manager",
+			expectedSkipped: true,
+		},
+		{
+			affected: `[{"package": ` + manager + `, "ranges": [{"type": "SEMVER", "events": [{"introduced": "1.2.0"}, {"fixed": "1.2.6"}]}]},
+				{"package": ` + engine + `, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.5.0"}]}]}]`,
+			packageName:   "",
+			expectedError: true,
+		},
+		{
+			affected:         `[{"package": ` + manager + `, "ranges": [{"type": "SEMVER", "events": [{"introduced": "1.2.0"}, {"fixed": "1.2.6"}]}]}]`,
+			packageName:      "",
+			expectedAffected: ">=1.2.0, <1.2.6",
+		},
+	}
+	for i, testCase := range testCases {
+		var o osvAdvisory
+		if err := json.Unmarshal([]byte(`{"id": "GHSA-0000-1111-2222", "affected": `+testCase.affected+`}`), &o); err != nil {
+			t.Fatalf("Test case %v: invalid OSV advisory: %v", i, err)
+		}
+		a, err := o.toAdvisory(testCase.packageName)
+		if testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: expected error %v but got %v", i, testCase.expectedError, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if testCase.expectedSkipped != (a == nil) {
+			t.Errorf("Test case %v: expected skipped %v but got %+v", i, testCase.expectedSkipped, a)
+			continue
+		}
+		if a == nil {
+			continue
+		}
+		if a.Affected != testCase.expectedAffected {
+			t.Errorf("Test case %v: affected range %v not equal to expected %v", i, a.Affected, testCase.expectedAffected)
+		}
+		if err := a.validate(); err != nil {
+			t.Errorf("Test case %v: invalid advisory: %v", i, err)
+		}
+	}
+}
+
+func TestAdvisoryAffects(t *testing.T) {
+	a := &Advisory{ID: "GHSA-0000-1111-2222", Affected: ">=1.2.0 <1.2.6 || >=1.3.0 <1.3.2 || ~1.4.1"}
+	if err := a.validate(); err != nil {
+		t.Fatalf("invalid advisory: %v", err)
+	}
+
+	testCases := []struct {
+		version  string
+		expected bool
+	}{
+		{version: "v1.1.3", expected: false},
+		{version: "v1.2.0", expected: true},
+		{version: "v1.2.5", expected: true},
+		{version: "v1.2.6", expected: false},
+		{version: "v1.3.1", expected: true},
+		{version: "v1.3.1-rc1", expected: true},
+		// pre-releases are compared by precedence, e.g. v1.2.6-rc1 < v1.2.6 and v1.2.0-rc1 < v1.2.0
+		{version: "v1.2.6-rc1", expected: true},
+		{version: "v1.2.0-rc1", expected: false},
+		{version: "v1.3.2-rc1", expected: true},
+		{version: "v1.3.2", expected: false},
+		// the other comparisons ignore the pre-release
+		{version: "v1.4.1-rc1", expected: true},
+		{version: "v1.4.2", expected: true},
+		{version: "v1.5.0", expected: false},
+	}
+	for i, testCase := range testCases {
+		if output := a.affects(semver.MustParse(testCase.version)); output != testCase.expected {
+			t.Errorf("Test case %v: %+v Output %v not equal to expected %v", i, testCase, output, testCase.expected)
+		}
+	}
+}
+
+func TestValidateAndLoadResponseConfigAdvisories(t *testing.T) {
+	versions := []Version{{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest"}}}
+
+	testCases := []struct {
+		advisories    []Advisory
+		expectedError bool
+	}{
+		{advisories: []Advisory{{ID: "CVE-1", Affected: "<1.2.6", FixedIn: []string{"v1.2.6"}}}, expectedError: false},
+		{advisories: []Advisory{{ID: "", Affected: "<1.2.6"}}, expectedError: true},
+		{advisories: []Advisory{{ID: "CVE-1", Affected: "not a range"}}, expectedError: true},
+		{advisories: []Advisory{{ID: "CVE-1", Affected: "<1.2.6", FixedIn: []string{"invalid"}}}, expectedError: true},
+		{advisories: []Advisory{{ID: "CVE-1", Affected: "<1.2.6"}, {ID: "CVE-1", Affected: "<1.3.0"}}, expectedError: true},
+	}
+
+	for i, testCase := range testCases {
+		s := &Server{
+			VersionMap:     map[string]*Version{},
+			TagVersionsMap: map[string][]*Version{},
+		}
+		err := s.validateAndLoadResponseConfig(&ResponseConfig{Versions: versions, Advisories: testCase.advisories})
+		if testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: expected error %v but got %v", i, testCase.expectedError, err)
+		}
+	}
+}
+
+func TestGenerateCheckUpgradeResponseWithAdvisories(t *testing.T) {
+	advisories, err := loadAdvisoriesDir("testdata/advisories", "")
+	if err != nil {
+		t.Fatalf("failed to load advisories: %v", err)
+	}
+	s := &Server{
+		VersionMap:     map[string]*Version{},
+		TagVersionsMap: map[string][]*Version{},
+	}
+	if err := s.validateAndLoadResponseConfig(&ResponseConfig{
+		Versions:   []Version{{Name: "v1.3.2", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest"}}},
+		Advisories: advisories,
+	}); err != nil {
+		t.Fatalf("failed to load response config: %v", err)
+	}
+
+	testCases := []struct {
+		appVersion string
+		expected   []string
+	}{
+		{appVersion: "v1.1.3", expected: []string{"GHSA-3333-4444-5555"}},
+		{appVersion: "v1.2.4", expected: []string{"GHSA-0000-1111-2222", "GHSA-3333-4444-5555"}},
+		{appVersion: "v1.3.1", expected: []string{"GHSA-0000-1111-2222"}},
+		{appVersion: "v1.3.2", expected: []string{}},
+		{appVersion: "invalid", expected: []string{}},
+	}
+	for i, testCase := range testCases {
+		resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: testCase.appVersion})
+		if err != nil {
+			t.Fatalf("Test case %v: unexpected error %v", i, err)
+		}
+		ids := []string{}
+		for _, a := range resp.Advisories {
+			ids = append(ids, a.ID)
+		}
+		if !equalStrings(ids, testCase.expected) {
+			t.Errorf("Test case %v: advisories %v not equal to expected %v", i, ids, testCase.expected)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultOverflowValue is the value stored instead of the new values of a tag exceeding its maximum cardinality
+	DefaultOverflowValue = "other"
+
+	cardinalityStateSaveInterval = time.Minute
+)
+
+// cardinalityGuard limits the number of distinct values of each tag observed in a sliding window, since the InfluxDB
+// memory usage grows with the tag cardinality. Only the values admitted are tracked, so the memory used for a tag is
+// bounded by its maximum cardinality.
+type cardinalityGuard struct {
+	sync.Mutex
+
+	window    time.Duration
+	statePath string // the file the values seen are persisted to if not empty
+	tags      map[string]*tagCardinality
+}
+
+type tagCardinality struct {
+	lastSeen    map[string]time.Time
+	overflowed  int64 // how many values were stored as the overflow value, kept across restarts with the state file
+	overflowing bool
+}
+
+// tagCardinalityState is the state of a tag persisted in the cardinality state file
+type tagCardinalityState struct {
+	LastSeen   map[string]time.Time `json:"lastSeen"`
+	Overflowed int64                `json:"overflowed,omitempty"`
+}
+
+// TagCardinalityStatus is the cardinality of a tag reported by the health check
+type TagCardinalityStatus struct {
+	DistinctValues   int   `json:"distinctValues"`   // the number of values tracked in the window
+	OverflowedValues int64 `json:"overflowedValues"` // how many values were stored as the overflow value
+}
+
+func newCardinalityGuard(window time.Duration, statePath string) *cardinalityGuard {
+	return &cardinalityGuard{
+		window:    window,
+		statePath: statePath,
+		tags:      map[string]*tagCardinality{},
+	}
+}
+
+// admit returns the value if it is among the maxCardinality distinct values of the tag seen in the window, or the
+// overflow value otherwise
+func (g *cardinalityGuard) admit(tag, value string, maxCardinality int, overflowValue string, now time.Time) string {
+	if maxCardinality <= 0 {
+		return value
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	t := g.tags[tag]
+	if t == nil {
+		t = &tagCardinality{lastSeen: map[string]time.Time{}}
+		g.tags[tag] = t
+	}
+	if _, ok := t.lastSeen[value]; ok {
+		t.lastSeen[value] = now
+		return value
+	}
+	if len(t.lastSeen) >= maxCardinality {
+		t.expire(now.Add(-g.window))
+	}
+	if len(t.lastSeen) < maxCardinality {
+		t.lastSeen[value] = now
+		t.overflowing = false
+		return value
+	}
+
+	if overflowValue == "" {
+		overflowValue = DefaultOverflowValue
+	}
+	t.overflowed++
+	if !t.overflowing {
+		t.overflowing = true
+		logrus.Warnf("Tag %v has more than %v distinct values in the last %v, the new values are stored as %v. %v value(s) overflowed so far",
+			tag, maxCardinality, g.window, overflowValue, t.overflowed)
+	}
+	return overflowValue
+}
+
+// expire forgets the values not seen since the cutoff
+func (t *tagCardinality) expire(cutoff time.Time) {
+	for value, lastSeen := range t.lastSeen {
+		if lastSeen.Before(cutoff) {
+			delete(t.lastSeen, value)
+		}
+	}
+}
+
+func (g *cardinalityGuard) status(now time.Time) map[string]TagCardinalityStatus {
+	g.Lock()
+	defer g.Unlock()
+
+	status := map[string]TagCardinalityStatus{}
+	for tag, t := range g.tags {
+		t.expire(now.Add(-g.window))
+		status[tag] = TagCardinalityStatus{DistinctValues: len(t.lastSeen), OverflowedValues: t.overflowed}
+	}
+	return status
+}
+
+// load restores the values seen in the window and the overflow counters from the state file if it exists
+func (g *cardinalityGuard) load(now time.Time) error {
+	content, err := os.ReadFile(filepath.Clean(g.statePath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fail to open cardinality state file at %v", g.statePath)
+	}
+	var state map[string]tagCardinalityState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return errors.Wrapf(err, "fail to decode cardinality state file at %v", g.statePath)
+	}
+
+	g.Lock()
+	defer g.Unlock()
+	for tag, tagState := range state {
+		t := &tagCardinality{lastSeen: tagState.LastSeen, overflowed: tagState.Overflowed}
+		if t.lastSeen == nil {
+			t.lastSeen = map[string]time.Time{}
+		}
+		t.expire(now.Add(-g.window))
+		g.tags[tag] = t
+	}
+	return nil
+}
+
+// save persists the values seen in the window and the overflow counters to the state file
+func (g *cardinalityGuard) save(now time.Time) error {
+	g.Lock()
+	state := map[string]tagCardinalityState{}
+	for tag, t := range g.tags {
+		t.expire(now.Add(-g.window))
+		lastSeen := make(map[string]time.Time, len(t.lastSeen))
+		for value, seen := range t.lastSeen {
+			lastSeen[value] = seen
+		}
+		state[tag] = tagCardinalityState{LastSeen: lastSeen, Overflowed: t.overflowed}
+	}
+	g.Unlock()
+
+	content, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "fail to encode cardinality state")
+	}
+	return writeFileAtomically(g.statePath, content)
+}
+
+// run persists the values seen periodically and when done is closed
+func (g *cardinalityGuard) run(done <-chan struct{}) {
+	ticker := time.NewTicker(cardinalityStateSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := g.save(timeNow()); err != nil {
+				logrus.Errorf("Failed to save cardinality state: %v", err)
+			}
+		case <-done:
+			if err := g.save(timeNow()); err != nil {
+				logrus.Errorf("Failed to save cardinality state: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// runCardinalityGuard saves the cardinality state periodically and when done is closed. Wait returns once the last
+// save is finished.
+func (s *Server) runCardinalityGuard(done <-chan struct{}) {
+	s.stopped.Add(1)
+	go func() {
+		defer s.stopped.Done()
+		s.cardinalityGuard.run(done)
+	}()
+}
+
+// guardTagCardinality returns the value of the tag, or its overflow value if the tag has too many distinct values
+func (s *Server) guardTagCardinality(tag, value string) string {
+	if s.cardinalityGuard == nil {
+		return value
+	}
+	s.RLock()
+	schema := s.RequestSchema.ExtraTagInfoSchema[tag]
+	s.RUnlock()
+	return s.cardinalityGuard.admit(tag, value, schema.MaxCardinality, schema.OverflowValue, timeNow())
+}
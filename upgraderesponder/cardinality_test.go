@@ -0,0 +1,182 @@
+package upgraderesponder
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCardinalityGuard(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := newCardinalityGuard(time.Hour, "")
+
+	testCases := []struct {
+		value    string
+		after    time.Duration
+		expected string
+	}{
+		{value: "a", after: 0, expected: "a"},
+		{value: "b", after: 10 * time.Minute, expected: "b"},
+		{value: "c", after: 20 * time.Minute, expected: "other"},
+		{value: "a", after: 30 * time.Minute, expected: "a"},
+		// b is not seen for more than the window, so c takes its place
+		{value: "c", after: 80 * time.Minute, expected: "c"},
+		{value: "b", after: 80 * time.Minute, expected: "other"},
+		{value: "a", after: 80 * time.Minute, expected: "a"},
+	}
+	for i, testCase := range testCases {
+		if output := g.admit("region", testCase.value, 2, "", start.Add(testCase.after)); output != testCase.expected {
+			t.Errorf("Test case %v: %v admitted as %v, expected %v", i, testCase.value, output, testCase.expected)
+		}
+	}
+
+	expected := map[string]TagCardinalityStatus{"region": {DistinctValues: 2, OverflowedValues: 2}}
+	if status := g.status(start.Add(80 * time.Minute)); !reflect.DeepEqual(status, expected) {
+		t.Errorf("status is %+v, expected %+v", status, expected)
+	}
+
+	if output := g.admit("zone", "z1", 0, "", start); output != "z1" {
+		t.Errorf("value of a tag without maxCardinality admitted as %v", output)
+	}
+	if output := g.admit("region", "d", 2, "unknown", start.Add(80*time.Minute)); output != "unknown" {
+		t.Errorf("value admitted as %v, expected the overflow value unknown", output)
+	}
+}
+
+func TestCardinalityGuardPersistence(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "cardinality.json")
+
+	g := newCardinalityGuard(time.Hour, path)
+	if err := g.load(start); err != nil {
+		t.Fatalf("failed to load missing state file: %v", err)
+	}
+	g.admit("region", "a", 2, "", start)
+	g.admit("region", "b", 2, "", start.Add(50*time.Minute))
+	g.admit("region", "c", 2, "", start.Add(50*time.Minute))
+	if err := g.save(start.Add(50 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a expires before the restart, b is restored
+	restarted := newCardinalityGuard(time.Hour, path)
+	if err := restarted.load(start.Add(70 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{"c", "c"},
+		{"d", "other"},
+		{"b", "b"},
+	}
+	for i, testCase := range testCases {
+		if output := restarted.admit("region", testCase.value, 2, "", start.Add(70*time.Minute)); output != testCase.expected {
+			t.Errorf("Test case %v: %v admitted as %v, expected %v", i, testCase.value, output, testCase.expected)
+		}
+	}
+
+	// The overflow counter continues from the value saved before the restart
+	expected := map[string]TagCardinalityStatus{"region": {DistinctValues: 2, OverflowedValues: 2}}
+	if status := restarted.status(start.Add(70 * time.Minute)); !reflect.DeepEqual(status, expected) {
+		t.Errorf("status after restart is %+v, expected %+v", status, expected)
+	}
+}
+
+func TestCardinalityGuardSavedOnShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cardinality.json")
+	s := &Server{cardinalityGuard: newCardinalityGuard(time.Hour, path)}
+	s.cardinalityGuard.admit("region", "a", 2, "", time.Now())
+
+	done := make(chan struct{})
+	s.runCardinalityGuard(done)
+	close(done)
+	s.Wait()
+
+	// The state is saved before Wait returns, long before the periodic save
+	restarted := newCardinalityGuard(time.Hour, path)
+	if err := restarted.load(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if status := restarted.status(time.Now()); status["region"].DistinctValues != 1 {
+		t.Errorf("state is not saved on shutdown: %+v", status)
+	}
+}
+
+func TestGuardTagCardinality(t *testing.T) {
+	s := &Server{cardinalityGuard: newCardinalityGuard(time.Hour, "")}
+	if err := s.validateAndLoadRequestSchema(RequestSchema{
+		AppVersionSchema: Schema{DataType: "string"},
+		ExtraTagInfoSchema: map[string]Schema{
+			"clusterName":       {DataType: "string", MaxCardinality: 1, OverflowValue: "many"},
+			"kubernetesVersion": {DataType: "string"},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		extraTagInfo map[string]string
+		expectedTags map[string]string
+	}{
+		{
+			extraTagInfo: map[string]string{"clusterName": "prod", "kubernetesVersion": "v1.27.4"},
+			expectedTags: map[string]string{"cluster_name": "prod", "kubernetes_version": "v1.27.4"},
+		},
+		{
+			extraTagInfo: map[string]string{"clusterName": "staging", "kubernetesVersion": "v1.28.0"},
+			expectedTags: map[string]string{"cluster_name": "many", "kubernetes_version": "v1.28.0"},
+		},
+	}
+	for i, testCase := range testCases {
+		tags := s.getTagsFromRequest(&CheckUpgradeRequest{AppVersion: "v1.0.0", ExtraTagInfo: testCase.extraTagInfo}, nil)
+		for key, expected := range testCase.expectedTags {
+			if tags[key] != expected {
+				t.Errorf("Test case %v: tag %v is %v, expected %v", i, key, tags[key], expected)
+			}
+		}
+	}
+}
+
+func TestCardinalitySchemaErrors(t *testing.T) {
+	testCases := []struct {
+		requestSchema RequestSchema
+		expectedError bool
+	}{
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema:   Schema{DataType: "string"},
+				ExtraTagInfoSchema: map[string]Schema{"region": {DataType: "string", MaxCardinality: 100}},
+			},
+			expectedError: false,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema:   Schema{DataType: "string"},
+				ExtraTagInfoSchema: map[string]Schema{"region": {DataType: "string", MaxCardinality: -1}},
+			},
+			expectedError: true,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema: Schema{DataType: "string", MaxCardinality: 100},
+			},
+			expectedError: true,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema:     Schema{DataType: "string"},
+				ExtraFieldInfoSchema: map[string]Schema{"nodeCount": {DataType: "int", MaxCardinality: 100}},
+			},
+			expectedError: true,
+		},
+	}
+	for i, testCase := range testCases {
+		s := &Server{}
+		if err := s.validateAndLoadRequestSchema(testCase.requestSchema); testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: unexpected error %v", i, err)
+		}
+	}
+}
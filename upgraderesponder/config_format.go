@@ -0,0 +1,456 @@
+package upgraderesponder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigFormatJSON = "json"
+	ConfigFormatYAML = "yaml"
+	ConfigFormatTOML = "toml"
+)
+
+// configLines maps the path of the entries in a config file, e.g. `versions.2` or `extraTagInfoSchema.nodeCount`,
+// to their line numbers so that the validation errors can point to the offending entry
+type configLines map[string]int
+
+// wrap prefixes the error with the line number of the entry at the path if known
+func (l configLines) wrap(err error, path ...interface{}) error {
+	if line := l[joinConfigPath(path...)]; line > 0 {
+		return errors.Wrapf(err, "line %v", line)
+	}
+	return err
+}
+
+func joinConfigPath(path ...interface{}) string {
+	elems := make([]string, len(path))
+	for i, elem := range path {
+		elems[i] = fmt.Sprint(elem)
+	}
+	return strings.Join(elems, ".")
+}
+
+// ValidateConfigFormat returns an error if the format is neither empty nor supported
+func ValidateConfigFormat(format string) error {
+	switch format {
+	case "", ConfigFormatJSON, ConfigFormatYAML, ConfigFormatTOML:
+		return nil
+	}
+	return fmt.Errorf("unsupported config format %v, must be %v, %v or %v", format, ConfigFormatJSON, ConfigFormatYAML, ConfigFormatTOML)
+}
+
+// configFormatOf returns the format of the config file, given explicitly or guessed from the file extension
+func configFormatOf(path, format string) string {
+	if format != "" {
+		return format
+	}
+	switch strings.ToLower(configSourceExt(path)) {
+	case ".yaml", ".yml":
+		return ConfigFormatYAML
+	case ".toml":
+		return ConfigFormatTOML
+	}
+	return ConfigFormatJSON
+}
+
+// decodeConfig decodes the JSON, YAML or TOML config into v. The YAML and TOML documents are converted to JSON
+// first, so that the same JSON field names and decoding rules apply to all formats.
+func decodeConfig(content []byte, format string, v interface{}) (configLines, error) {
+	var (
+		lines configLines
+		err   error
+	)
+	switch format {
+	case ConfigFormatJSON:
+		lines = jsonLines(content)
+	case ConfigFormatYAML:
+		if content, lines, err = yamlToJSON(content); err != nil {
+			return nil, err
+		}
+	case ConfigFormatTOML:
+		if content, lines, err = tomlToJSON(content); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ValidateConfigFormat(format)
+	}
+
+	if err := json.Unmarshal(content, v); err != nil {
+		if format == ConfigFormatJSON {
+			var offset int64 = -1
+			switch e := err.(type) {
+			case *json.SyntaxError:
+				offset = e.Offset
+			case *json.UnmarshalTypeError:
+				offset = e.Offset
+			}
+			if offset >= 0 {
+				return nil, errors.Wrapf(err, "line %v", lineAt(content, offset))
+			}
+		}
+		return nil, err
+	}
+	return lines, nil
+}
+
+// encodeConfig encodes v in the format. The YAML and TOML documents are converted from the JSON one, so their keys
+// are sorted and the null values are omitted.
+func encodeConfig(v interface{}, format string) ([]byte, error) {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to encode config")
+	}
+	if format == ConfigFormatJSON {
+		return append(content, '\n'), nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, errors.Wrap(err, "fail to encode config")
+	}
+	doc = omitNullValues(doc)
+	switch format {
+	case ConfigFormatYAML:
+		return yaml.Marshal(doc)
+	case ConfigFormatTOML:
+		buf := &bytes.Buffer{}
+		if err := toml.NewEncoder(buf).Encode(doc); err != nil {
+			return nil, errors.Wrap(err, "fail to encode config in TOML")
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, ValidateConfigFormat(format)
+}
+
+// updateYAMLConfig encodes v, a pointer to a config, in YAML by updating the nodes of the original document in place, so that the comments,
+// the key order and the styles of the entries left unchanged are kept
+func updateYAMLConfig(original []byte, v interface{}) ([]byte, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to encode config")
+	}
+	var doc interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, errors.Wrap(err, "fail to encode config")
+	}
+	doc = omitNullValues(doc)
+
+	// The empty strings added are omitted to keep the file as written by hand, unless it changes the decoded config,
+	// e.g. for an empty value of a map
+	for _, omitEmpty := range []bool{true, false} {
+		updated, err := mergeYAMLConfig(original, doc, omitEmpty)
+		if err != nil {
+			return nil, err
+		}
+		converted, _, err := yamlToJSON(updated)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to decode updated YAML config")
+		}
+		decoded := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+		if err := json.Unmarshal(converted, decoded); err != nil {
+			return nil, errors.Wrap(err, "fail to decode updated YAML config")
+		}
+		if decodedContent, err := json.Marshal(decoded); err == nil && bytes.Equal(decodedContent, content) {
+			return updated, nil
+		}
+	}
+	return nil, fmt.Errorf("fail to update YAML config in place")
+}
+
+func mergeYAMLConfig(original []byte, doc interface{}, omitEmpty bool) ([]byte, error) {
+	var updated yaml.Node
+	if err := updated.Encode(doc); err != nil {
+		return nil, errors.Wrap(err, "fail to encode config in YAML")
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(original, &node); err != nil {
+		return nil, err
+	}
+	if node.Kind == yaml.DocumentNode && len(node.Content) == 1 {
+		node.Content[0] = mergeYAMLNode(node.Content[0], &updated, omitEmpty)
+	} else {
+		node = updated
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, errors.Wrap(err, "fail to encode config in YAML")
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, errors.Wrap(err, "fail to encode config in YAML")
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeYAMLNode returns the original node updated to the value of the updated one. The original nodes are reused
+// where the value is unchanged, and the mapping keys and sequence items are matched so that their comments follow
+// them.
+func mergeYAMLNode(original, updated *yaml.Node, omitEmpty bool) *yaml.Node {
+	if original.Kind != updated.Kind {
+		copyYAMLComments(updated, original)
+		return updated
+	}
+
+	switch updated.Kind {
+	case yaml.ScalarNode:
+		if original.Value == updated.Value {
+			return original
+		}
+		copyYAMLComments(updated, original)
+		return updated
+	case yaml.MappingNode:
+		updatedValues := map[string]*yaml.Node{}
+		for i := 0; i+1 < len(updated.Content); i += 2 {
+			updatedValues[updated.Content[i].Value] = updated.Content[i+1]
+		}
+		var content []*yaml.Node
+		kept := map[string]bool{}
+		// The keys removed are dropped, the keys kept stay in the original order and the keys added are appended
+		for i := 0; i+1 < len(original.Content); i += 2 {
+			key := original.Content[i]
+			if value, ok := updatedValues[key.Value]; ok {
+				content = append(content, key, mergeYAMLNode(original.Content[i+1], value, omitEmpty))
+				kept[key.Value] = true
+			}
+		}
+		for i := 0; i+1 < len(updated.Content); i += 2 {
+			if !kept[updated.Content[i].Value] && !(omitEmpty && isEmptyYAMLString(updated.Content[i+1])) {
+				content = append(content, updated.Content[i], updated.Content[i+1])
+			}
+		}
+		original.Content = content
+		return original
+	case yaml.SequenceNode:
+		// The items are matched by value for the scalars and by name for the mappings, e.g. the versions, so that
+		// removing an item doesn't shift the comments of the following ones
+		used := make([]bool, len(original.Content))
+		content := make([]*yaml.Node, len(updated.Content))
+		for i, item := range updated.Content {
+			match := -1
+			if id := yamlItemID(item); id != "" {
+				for j, candidate := range original.Content {
+					if !used[j] && yamlItemID(candidate) == id {
+						match = j
+						break
+					}
+				}
+			} else if i < len(original.Content) && !used[i] && yamlItemID(original.Content[i]) == "" {
+				match = i
+			}
+			if match >= 0 {
+				used[match] = true
+				content[i] = mergeYAMLNode(original.Content[match], item, omitEmpty)
+				continue
+			}
+			// An item added is laid out like the first original item, e.g. a new version like the existing ones
+			if len(original.Content) > 0 && original.Content[0].Kind == yaml.MappingNode && item.Kind == yaml.MappingNode {
+				item = mergeYAMLNode(&yaml.Node{Kind: yaml.MappingNode, Content: yamlKeys(original.Content[0])}, item, omitEmpty)
+			}
+			content[i] = item
+		}
+		original.Content = content
+		return original
+	}
+	return updated
+}
+
+// yamlKeys returns the keys of the mapping paired with empty values, to lay out another mapping in the same order
+func yamlKeys(n *yaml.Node) []*yaml.Node {
+	var content []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Value: n.Content[i].Value}, &yaml.Node{})
+	}
+	return content
+}
+
+func isEmptyYAMLString(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.ShortTag() == "!!str" && n.Value == ""
+}
+
+// yamlItemID identifies a sequence item by its value if it is a scalar or by its name if it is a mapping with one
+func yamlItemID(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return "value=" + n.Value
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == "name" && n.Content[i+1].Kind == yaml.ScalarNode {
+				return "name=" + n.Content[i+1].Value
+			}
+		}
+	}
+	return ""
+}
+
+func copyYAMLComments(to, from *yaml.Node) {
+	to.HeadComment = from.HeadComment
+	to.LineComment = from.LineComment
+	to.FootComment = from.FootComment
+}
+
+// omitNullValues removes the null values from the objects of the decoded JSON document since TOML has no null
+func omitNullValues(doc interface{}) interface{} {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if value == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = omitNullValues(value)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = omitNullValues(v[i])
+		}
+	}
+	return doc
+}
+
+// lineAt returns the line number of the byte offset in the content
+func lineAt(content []byte, offset int64) int {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+// jsonLines indexes the line numbers of the entries of the JSON document. It returns nil if the document is invalid,
+// in which case decoding it reports the error.
+func jsonLines(content []byte) configLines {
+	lines := configLines{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	var walk func(path string) error
+	walk = func(path string) error {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		// The offset is right after the token, which is on the same line as its start
+		if path != "" {
+			lines[path] = lineAt(content, decoder.InputOffset()-1)
+		}
+		delim, ok := token.(json.Delim)
+		if !ok {
+			return nil
+		}
+		switch delim {
+		case '{':
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				if err := walk(childConfigPath(path, fmt.Sprint(key))); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for i := 0; decoder.More(); i++ {
+				if err := walk(childConfigPath(path, strconv.Itoa(i))); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = decoder.Token()
+		return err
+	}
+	if err := walk(""); err != nil && err != io.EOF {
+		return nil
+	}
+	return lines
+}
+
+func childConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func yamlToJSON(content []byte) ([]byte, configLines, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(content, &node); err != nil {
+		return nil, nil, err
+	}
+	var doc interface{}
+	if err := node.Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+	converted, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "fail to convert YAML to JSON")
+	}
+
+	lines := configLines{}
+	// The entry of a mapping starts at its key, the entry of a sequence at its value
+	var walk func(n *yaml.Node, path string, line int)
+	walk = func(n *yaml.Node, path string, line int) {
+		if path != "" {
+			lines[path] = line
+		}
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, child := range n.Content {
+				walk(child, path, child.Line)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				walk(n.Content[i+1], childConfigPath(path, n.Content[i].Value), n.Content[i].Line)
+			}
+		case yaml.SequenceNode:
+			for i, child := range n.Content {
+				walk(child, childConfigPath(path, strconv.Itoa(i)), child.Line)
+			}
+		}
+	}
+	walk(&node, "", node.Line)
+	return converted, lines, nil
+}
+
+var tomlTableHeaderRegexp = regexp.MustCompile(`^\s*(\[\[?)\s*([A-Za-z0-9_.-]+)\s*\]\]?`)
+
+func tomlToJSON(content []byte) ([]byte, configLines, error) {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(content), &doc); err != nil {
+		return nil, nil, err
+	}
+	converted, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "fail to convert TOML to JSON")
+	}
+
+	// Only the table headers are indexed, e.g. the nth `[[versions]]` is `versions.n` and `[extraTagInfoSchema.x]`
+	// is `extraTagInfoSchema.x`, which covers the entries validated one by one
+	lines := configLines{}
+	arrayCounts := map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		match := tomlTableHeaderRegexp.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		path := match[2]
+		if match[1] == "[[" {
+			index := arrayCounts[path]
+			arrayCounts[path]++
+			path = childConfigPath(path, strconv.Itoa(index))
+		}
+		lines[path] = lineNumber
+	}
+	return converted, lines, nil
+}
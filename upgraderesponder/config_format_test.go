@@ -0,0 +1,188 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadResponseConfigFormats(t *testing.T) {
+	expected, err := loadResponseConfig(ConfigFiles{ResponseConfigFilePath: "testdata/config/response.json"})
+	if err != nil {
+		t.Fatalf("failed to load JSON response config: %v", err)
+	}
+	expectedJSON, _ := json.Marshal(expected)
+
+	for _, path := range []string{"testdata/config/response.yaml", "testdata/config/response.toml"} {
+		config, err := loadResponseConfig(ConfigFiles{ResponseConfigFilePath: path})
+		if err != nil {
+			t.Fatalf("failed to load response config %v: %v", path, err)
+		}
+		configJSON, _ := json.Marshal(config)
+		if string(configJSON) != string(expectedJSON) {
+			t.Errorf("response config %v is %s, not equal to expected %s", path, configJSON, expectedJSON)
+		}
+		s := &Server{
+			VersionMap:     map[string]*Version{},
+			TagVersionsMap: map[string][]*Version{},
+		}
+		if err := s.validateAndLoadResponseConfig(config); err != nil {
+			t.Errorf("invalid response config %v: %v", path, err)
+		}
+	}
+
+	// The explicit format overrides the file extension
+	dir := t.TempDir()
+	path := filepath.Join(dir, "response.conf")
+	content, err := os.ReadFile("testdata/config/response.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadResponseConfig(ConfigFiles{ResponseConfigFilePath: path}); err == nil {
+		t.Errorf("expected error for YAML response config decoded as JSON")
+	}
+	if _, err := loadResponseConfig(ConfigFiles{ResponseConfigFilePath: path, ConfigFormat: ConfigFormatYAML}); err != nil {
+		t.Errorf("failed to load YAML response config with explicit format: %v", err)
+	}
+	if _, err := loadResponseConfig(ConfigFiles{ResponseConfigFilePath: path, ConfigFormat: "xml"}); err == nil {
+		t.Errorf("expected error for unsupported format")
+	}
+}
+
+func TestConfigErrorLineNumbers(t *testing.T) {
+	testCases := []struct {
+		format        string
+		content       string
+		expectedLines []string
+	}{
+		{
+			format: ConfigFormatJSON,
+			content: `{
+	"versions": [
+		{"name": "v1.0.0", "releaseDate": "2020-05-30T10:20:00Z", "tags": ["latest"]},
+		{"name": "v1.1.0", "releaseDate": "invalid", "tags": ["latest"]}
+	],
+	"channels": ["unknown"]
+}`,
+			expectedLines: []string{"line 4: invalid release date of version v1.1.0", "line 6: invalid channel unknown"},
+		},
+		{
+			format: ConfigFormatYAML,
+			content: `versions:
+  - name: v1.0.0
+    releaseDate: "2020-05-30T10:20:00Z"
+    tags: [latest]
+  # invalid version
+  - name: invalid
+    releaseDate: "2020-05-30T10:20:00Z"
+    tags: [latest]
+`,
+			expectedLines: []string{"line 6: invalid name invalid"},
+		},
+		{
+			format: ConfigFormatTOML,
+			content: `[[versions]]
+name = "v1.0.0"
+releaseDate = "2020-05-30T10:20:00Z"
+tags = ["latest"]
+
+[[versions]]
+name = "v1.0.0"
+releaseDate = "2020-05-30T10:20:00Z"
+tags = ["latest"]
+`,
+			expectedLines: []string{"line 6: invalid duplicate name v1.0.0"},
+		},
+		{
+			format:        ConfigFormatJSON,
+			content:       "{\n\t\"versions\": [\n\t\t{\"name\": 1}\n\t]\n}",
+			expectedLines: []string{"line 3: json: cannot unmarshal number"},
+		},
+		{
+			format:        ConfigFormatYAML,
+			content:       "versions:\n  - name: v1.0.0\n  tags: [latest",
+			expectedLines: []string{"yaml: line 1"},
+		},
+		{
+			format:        ConfigFormatTOML,
+			content:       "[[versions]]\nname = \"v1.0.0\"\ntags = [\"latest\"\n",
+			expectedLines: []string{"toml: line 3"},
+		},
+	}
+
+	for i, testCase := range testCases {
+		var config ResponseConfig
+		lines, err := decodeConfig([]byte(testCase.content), testCase.format, &config)
+		if err == nil {
+			config.lines = lines
+			s := &Server{
+				VersionMap:     map[string]*Version{},
+				TagVersionsMap: map[string][]*Version{},
+			}
+			err = s.validateAndLoadResponseConfig(&config)
+		}
+		if err == nil {
+			t.Errorf("Test case %v: expected error", i)
+			continue
+		}
+		for _, expected := range testCase.expectedLines {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("Test case %v: error %q doesn't contain %q", i, err.Error(), expected)
+			}
+		}
+	}
+}
+
+func TestLoadRequestSchemaYAML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "schema.yml")
+	if err := os.WriteFile(path, []byte(`appVersionSchema:
+  dataType: string
+  maxLen: 200
+extraTagInfoSchema:
+  kubernetesVersion:
+    dataType: string
+    maxLen: 200
+  nodeCount:
+    dataType: float
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	requestSchema, err := loadRequestSchema(path, "")
+	if err != nil {
+		t.Fatalf("failed to load request schema: %v", err)
+	}
+	err = (&Server{}).validateAndLoadRequestSchema(*requestSchema)
+	if err == nil || !strings.Contains(err.Error(), "line 8: tag schema nodeCount") {
+		t.Errorf("expected error of nodeCount at line 8 but got %v", err)
+	}
+}
+
+func TestEncodeConfig(t *testing.T) {
+	expected, err := loadResponseConfig(ConfigFiles{ResponseConfigFilePath: "testdata/config/response.json"})
+	if err != nil {
+		t.Fatalf("failed to load JSON response config: %v", err)
+	}
+	expectedJSON, _ := json.Marshal(expected)
+
+	for _, format := range []string{ConfigFormatJSON, ConfigFormatYAML, ConfigFormatTOML} {
+		content, err := encodeConfig(expected, format)
+		if err != nil {
+			t.Fatalf("failed to encode response config in %v: %v", format, err)
+		}
+		config := &ResponseConfig{}
+		if _, err := decodeConfig(content, format, config); err != nil {
+			t.Fatalf("failed to decode response config encoded in %v: %v\n%s", format, err, content)
+		}
+		configJSON, _ := json.Marshal(config)
+		if string(configJSON) != string(expectedJSON) {
+			t.Errorf("response config encoded in %v is %s, not equal to expected %s", format, configJSON, expectedJSON)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package upgraderesponder
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+const (
+	AdminActionRollback = "rollback"
+
+	// configHistorySize is how many previous response configs are kept
+	configHistorySize = 20
+
+	configHistoryFileSuffix = ".history.json"
+)
+
+var (
+	ErrSnapshotNotFound    = errors.New("config snapshot not found")
+	ErrAmbiguousHashPrefix = errors.New("ambiguous config snapshot hash prefix")
+	ErrSnapshotInUse       = errors.New("config snapshot already in use")
+)
+
+// ConfigSnapshot is the content of a response config loaded by the server
+type ConfigSnapshot struct {
+	Hash       string `json:"hash"` // hex encoded SHA-256 of the content
+	LoadedAt   string `json:"loadedAt"`
+	ReplacedAt string `json:"replacedAt,omitempty"`
+	Content    string `json:"content,omitempty"`
+}
+
+// configHistoryState is the content of the config history file, which keeps the history across restarts
+type configHistoryState struct {
+	Current *ConfigSnapshot   `json:"current"`
+	History []*ConfigSnapshot `json:"history"`
+}
+
+// RollbackRequest is the body of the request to restore a previous response config
+type RollbackRequest struct {
+	// Hash is the hash, or a unique prefix of it, of the snapshot to restore. The most recent one is restored if empty
+	Hash string `json:"hash"`
+}
+
+func newConfigSnapshot(content []byte, now time.Time) *ConfigSnapshot {
+	return &ConfigSnapshot{
+		Hash:     fmt.Sprintf("%x", sha256.Sum256(content)),
+		LoadedAt: now.UTC().Format(time.RFC3339),
+		Content:  string(content),
+	}
+}
+
+// configHistoryFilePath returns the path of the config history file kept next to the change log, e.g.
+// `response.json.changes.history.json` for `response.json.changes.jsonl`
+func configHistoryFilePath(changeLogFilePath string) string {
+	return strings.TrimSuffix(changeLogFilePath, filepath.Ext(changeLogFilePath)) + configHistoryFileSuffix
+}
+
+// setResponseConfigSnapshot sets the snapshot of the response config in use and adds the replaced one to the
+// history if the content changed. It returns whether the history changed. The caller must hold the lock.
+func (s *Server) setResponseConfigSnapshot(snapshot *ConfigSnapshot) bool {
+	if snapshot == nil || (s.responseConfig != nil && s.responseConfig.Hash == snapshot.Hash) {
+		return false
+	}
+	if s.responseConfig != nil {
+		replaced := *s.responseConfig
+		replaced.ReplacedAt = snapshot.LoadedAt
+		s.pushConfigHistory(&replaced)
+	}
+	s.responseConfig = snapshot
+	return true
+}
+
+// pushConfigHistory adds the replaced snapshot to the history, dropping the oldest ones beyond the history size.
+// The caller must hold the lock.
+func (s *Server) pushConfigHistory(replaced *ConfigSnapshot) {
+	s.responseConfigHistory = append([]*ConfigSnapshot{replaced}, s.responseConfigHistory...)
+	if len(s.responseConfigHistory) > configHistorySize {
+		s.responseConfigHistory = s.responseConfigHistory[:configHistorySize]
+	}
+}
+
+// loadConfigHistory restores the history saved by the previous run of the server, so that a rollback is still
+// possible after a restart. If the response config was changed while the server was down, the config in use before
+// is added to the history.
+func (s *Server) loadConfigHistory() error {
+	content, err := os.ReadFile(filepath.Clean(s.configHistoryFilePath))
+	if os.IsNotExist(err) {
+		return s.saveConfigHistory()
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fail to open config history file at %v", s.configHistoryFilePath)
+	}
+	var state configHistoryState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return errors.Wrapf(err, "fail to decode config history file at %v", s.configHistoryFilePath)
+	}
+
+	s.Lock()
+	s.responseConfigHistory = state.History
+	if state.Current != nil && s.responseConfig != nil {
+		if state.Current.Hash == s.responseConfig.Hash {
+			s.responseConfig = state.Current
+		} else {
+			state.Current.ReplacedAt = s.responseConfig.LoadedAt
+			s.pushConfigHistory(state.Current)
+		}
+	}
+	s.Unlock()
+	return s.saveConfigHistory()
+}
+
+// saveConfigHistory writes the response config in use and the history to the config history file
+func (s *Server) saveConfigHistory() error {
+	s.configHistoryLock.Lock()
+	defer s.configHistoryLock.Unlock()
+
+	s.RLock()
+	state := configHistoryState{Current: s.responseConfig, History: s.responseConfigHistory}
+	content, err := json.Marshal(state)
+	s.RUnlock()
+	if err != nil {
+		return errors.Wrap(err, "fail to encode config history")
+	}
+	return writeFileAtomically(s.configHistoryFilePath, content)
+}
+
+// findConfigSnapshot returns the snapshot of the response config in use or in the history whose hash starts with
+// the prefix, or the most recent one in the history if the prefix is empty
+func (s *Server) findConfigSnapshot(prefix string) (*ConfigSnapshot, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if prefix == "" {
+		if len(s.responseConfigHistory) == 0 {
+			return nil, errors.Wrap(ErrSnapshotNotFound, "empty history")
+		}
+		return s.responseConfigHistory[0], nil
+	}
+	var found *ConfigSnapshot
+	for _, snapshot := range append([]*ConfigSnapshot{s.responseConfig}, s.responseConfigHistory...) {
+		if snapshot == nil || !strings.HasPrefix(snapshot.Hash, prefix) {
+			continue
+		}
+		if found != nil && found.Hash != snapshot.Hash {
+			return nil, errors.Wrapf(ErrAmbiguousHashPrefix, "%v", prefix)
+		}
+		found = snapshot
+	}
+	if found == nil {
+		return nil, errors.Wrapf(ErrSnapshotNotFound, "%v", prefix)
+	}
+	return found, nil
+}
+
+// AdminListHistory responds with the response config in use followed by the previous ones, newest first, without
+// their content
+func (s *Server) AdminListHistory(rw http.ResponseWriter, req *http.Request, user string) {
+	s.RLock()
+	history := []ConfigSnapshot{}
+	for _, snapshot := range append([]*ConfigSnapshot{s.responseConfig}, s.responseConfigHistory...) {
+		if snapshot != nil {
+			history = append(history, ConfigSnapshot{Hash: snapshot.Hash, LoadedAt: snapshot.LoadedAt, ReplacedAt: snapshot.ReplacedAt})
+		}
+	}
+	s.RUnlock()
+
+	if err := respondWithJSON(rw, history); err != nil {
+		logrus.Errorf("Failed to respondWithJSON: %v", err)
+	}
+}
+
+// AdminGetHistory responds with the response config whose hash starts with the one in the path
+func (s *Server) AdminGetHistory(rw http.ResponseWriter, req *http.Request, user string) {
+	snapshot, err := s.findConfigSnapshot(mux.Vars(req)["hash"])
+	if err != nil {
+		respondWithAdminError(rw, err)
+		return
+	}
+	if err := respondWithJSON(rw, snapshot); err != nil {
+		logrus.Errorf("Failed to respondWithJSON: %v", err)
+	}
+}
+
+// AdminRollback restores a previous response config if it is still valid
+func (s *Server) AdminRollback(rw http.ResponseWriter, req *http.Request, user string) {
+	var rollbackReq RollbackRequest
+	if err := json.NewDecoder(req.Body).Decode(&rollbackReq); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snapshot, err := s.findConfigSnapshot(rollbackReq.Hash)
+	if err != nil {
+		respondWithAdminError(rw, err)
+		return
+	}
+
+	s.adminLock.Lock()
+	defer s.adminLock.Unlock()
+
+	s.RLock()
+	inUse := s.responseConfig != nil && s.responseConfig.Hash == snapshot.Hash
+	s.RUnlock()
+	if inUse {
+		respondWithAdminError(rw, errors.Wrapf(ErrSnapshotInUse, "%v", snapshot.Hash))
+		return
+	}
+
+	change := &ConfigChange{
+		Time:   timeNow().UTC().Format(time.RFC3339),
+		User:   user,
+		Action: AdminActionRollback,
+		Hash:   snapshot.Hash,
+	}
+	if err := s.commitResponseConfig([]byte(snapshot.Content), change); err != nil {
+		respondWithAdminError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
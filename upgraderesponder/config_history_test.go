@@ -0,0 +1,227 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigHistory(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now, _ := ParseTime("2022-06-15T00:00:00Z")
+	timeNow = func() time.Time { return now }
+
+	dir := t.TempDir()
+	s := &Server{
+		configFiles:       ConfigFiles{ResponseConfigFilePath: filepath.Join(dir, "response.json")},
+		changeLogFilePath: filepath.Join(dir, "response.json"+defaultChangeLogSuffix),
+		adminTokens:       map[string]string{"token-a": "alice"},
+	}
+	router := NewRouter(s)
+
+	configs := []string{
+		`{"versions": [{"name": "v1.0.0", "releaseDate": "2020-05-30T10:20:00Z", "tags": ["latest"]}]}`,
+		`{"versions": [{"name": "v1.1.0", "releaseDate": "2020-06-30T10:20:00Z", "tags": ["latest"]}]}`,
+		`{"versions": [{"name": "v1.2.0", "releaseDate": "2020-07-30T10:20:00Z", "tags": ["latest"]}]}`,
+	}
+	for i, config := range configs {
+		now = now.Add(time.Hour)
+		if err := os.WriteFile(s.configFiles.ResponseConfigFilePath, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.ReloadResponseConfig(); err != nil {
+			t.Fatalf("failed to load response config %v: %v", i, err)
+		}
+		// Reloading the same content doesn't add to the history
+		if err := s.ReloadResponseConfig(); err != nil {
+			t.Fatalf("failed to reload response config %v: %v", i, err)
+		}
+	}
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token-a")
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, req)
+		return rw
+	}
+	listHistory := func() []ConfigSnapshot {
+		rw := serve("GET", "/v1/admin/history", "")
+		if rw.Code != http.StatusOK {
+			t.Fatalf("failed to list history: %v %v", rw.Code, rw.Body.String())
+		}
+		var history []ConfigSnapshot
+		if err := json.Unmarshal(rw.Body.Bytes(), &history); err != nil {
+			t.Fatal(err)
+		}
+		return history
+	}
+
+	history := listHistory()
+	if len(history) != len(configs) {
+		t.Fatalf("history has %v snapshots, expected %v: %+v", len(history), len(configs), history)
+	}
+	for i, snapshot := range history {
+		expected := newConfigSnapshot([]byte(configs[len(configs)-1-i]), now)
+		if snapshot.Hash != expected.Hash {
+			t.Errorf("snapshot %v has hash %v, expected %v", i, snapshot.Hash, expected.Hash)
+		}
+		if snapshot.Content != "" {
+			t.Errorf("snapshot %v is listed with its content", i)
+		}
+	}
+	if history[0].ReplacedAt != "" || history[1].ReplacedAt != "2022-06-15T03:00:00Z" || history[1].LoadedAt != "2022-06-15T02:00:00Z" {
+		t.Errorf("unexpected snapshot times: %+v", history)
+	}
+
+	testCases := []struct {
+		method          string
+		path            string
+		body            string
+		expectedCode    int
+		expectedContent string
+		expectedName    string
+	}{
+		{"GET", "/v1/admin/history/" + history[2].Hash[:8], "", http.StatusOK, configs[0], "v1.2.0"},
+		{"GET", "/v1/admin/history/" + history[0].Hash, "", http.StatusOK, configs[2], "v1.2.0"},
+		{"GET", "/v1/admin/history/unknown", "", http.StatusNotFound, "", "v1.2.0"},
+		{"POST", "/v1/admin/rollback", `{"hash": "unknown"}`, http.StatusNotFound, "", "v1.2.0"},
+		{"POST", "/v1/admin/rollback", `{"hash": `, http.StatusBadRequest, "", "v1.2.0"},
+		// The config in use cannot be restored
+		{"POST", "/v1/admin/rollback", `{"hash": "` + history[0].Hash + `"}`, http.StatusConflict, "", "v1.2.0"},
+		{"POST", "/v1/admin/rollback", `{"hash": "` + history[2].Hash[:8] + `"}`, http.StatusNoContent, "", "v1.0.0"},
+		// Without hash, the most recent snapshot is restored, which undoes the previous rollback
+		{"POST", "/v1/admin/rollback", `{}`, http.StatusNoContent, "", "v1.2.0"},
+	}
+
+	for i, tc := range testCases {
+		rw := serve(tc.method, tc.path, tc.body)
+		if rw.Code != tc.expectedCode {
+			t.Errorf("Test case %v: %v %v responded %v: %v, expected %v", i, tc.method, tc.path, rw.Code, rw.Body.String(), tc.expectedCode)
+		}
+		if tc.expectedContent != "" {
+			var snapshot ConfigSnapshot
+			if err := json.Unmarshal(rw.Body.Bytes(), &snapshot); err != nil {
+				t.Fatal(err)
+			}
+			if snapshot.Content != tc.expectedContent {
+				t.Errorf("Test case %v: snapshot content is %v, expected %v", i, snapshot.Content, tc.expectedContent)
+			}
+		}
+		if len(s.TagVersionsMap[VersionTagLatest]) != 1 || s.TagVersionsMap[VersionTagLatest][0].Name != tc.expectedName {
+			t.Errorf("Test case %v: latest version is %+v, expected %v", i, s.TagVersionsMap[VersionTagLatest], tc.expectedName)
+		}
+	}
+
+	content, err := os.ReadFile(s.configFiles.ResponseConfigFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != configs[2] {
+		t.Errorf("rolled back response config file is %s, expected %s", content, configs[2])
+	}
+	changeLog, err := os.ReadFile(s.changeLogFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(changeLog), `"action":"`+AdminActionRollback+`"`); n != 2 {
+		t.Errorf("change log has %v rollbacks, expected 2: %s", n, changeLog)
+	}
+}
+
+func TestConfigHistoryPersistence(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now, _ := ParseTime("2022-06-15T00:00:00Z")
+	timeNow = func() time.Time { return now }
+
+	dir := t.TempDir()
+	configs := []string{
+		`{"versions": [{"name": "v1.0.0", "releaseDate": "2020-05-30T10:20:00Z", "tags": ["latest"]}]}`,
+		`{"versions": [{"name": "v1.1.0", "releaseDate": "2020-06-30T10:20:00Z", "tags": ["latest"]}]}`,
+		`{"versions": [{"name": "v1.2.0", "releaseDate": "2020-07-30T10:20:00Z", "tags": ["latest"]}]}`,
+	}
+	// start loads the response config file then the history saved by the previous run, like NewServer
+	start := func(config string) *Server {
+		now = now.Add(time.Hour)
+		s := &Server{
+			configFiles:       ConfigFiles{ResponseConfigFilePath: filepath.Join(dir, "response.json")},
+			changeLogFilePath: filepath.Join(dir, "response.json"+defaultChangeLogSuffix),
+		}
+		if err := os.WriteFile(s.configFiles.ResponseConfigFilePath, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.ReloadResponseConfig(); err != nil {
+			t.Fatalf("failed to load response config: %v", err)
+		}
+		s.configHistoryFilePath = configHistoryFilePath(s.changeLogFilePath)
+		if err := s.loadConfigHistory(); err != nil {
+			t.Fatalf("failed to load config history: %v", err)
+		}
+		return s
+	}
+	hashes := func(s *Server) []string {
+		var hashes []string
+		for _, snapshot := range s.responseConfigHistory {
+			hashes = append(hashes, snapshot.Hash)
+		}
+		return hashes
+	}
+	hashOf := func(config string) string {
+		return newConfigSnapshot([]byte(config), now).Hash
+	}
+
+	s := start(configs[0])
+	if history := hashes(s); len(history) != 0 {
+		t.Errorf("history of the first run is %v, expected empty", history)
+	}
+	now = now.Add(time.Hour)
+	if err := s.reloadResponseConfig([]byte(configs[1])); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		config          string
+		expectedHistory []string
+	}{
+		// Restarted with the same config, the history is kept
+		{config: configs[1], expectedHistory: []string{hashOf(configs[0])}},
+		// Restarted with a config changed while the server was down, the config in use before is added
+		{config: configs[2], expectedHistory: []string{hashOf(configs[1]), hashOf(configs[0])}},
+	}
+	for i, tc := range testCases {
+		s = start(tc.config)
+		if history := hashes(s); strings.Join(history, ",") != strings.Join(tc.expectedHistory, ",") {
+			t.Errorf("Test case %v: history after restart is %v, expected %v", i, history, tc.expectedHistory)
+		}
+		if s.responseConfig.Hash != hashOf(tc.config) {
+			t.Errorf("Test case %v: config in use is %v, expected %v", i, s.responseConfig.Hash, hashOf(tc.config))
+		}
+	}
+	if s.responseConfigHistory[0].ReplacedAt != s.responseConfig.LoadedAt {
+		t.Errorf("config replaced while the server was down has replacedAt %v, expected %v", s.responseConfigHistory[0].ReplacedAt, s.responseConfig.LoadedAt)
+	}
+	// The restored snapshots keep their content, so that they can be rolled back to
+	if snapshot, err := s.findConfigSnapshot(""); err != nil || snapshot.Content != configs[1] {
+		t.Errorf("most recent snapshot after restart is %+v: %v", snapshot, err)
+	}
+}
+
+func TestConfigHistorySize(t *testing.T) {
+	s := &Server{}
+	now := time.Now()
+	for i := 0; i < configHistorySize+5; i++ {
+		s.setResponseConfigSnapshot(newConfigSnapshot([]byte(fmt.Sprint(i)), now))
+	}
+	if len(s.responseConfigHistory) != configHistorySize {
+		t.Errorf("history has %v snapshots, expected %v", len(s.responseConfigHistory), configHistorySize)
+	}
+	if expected := newConfigSnapshot([]byte(fmt.Sprint(configHistorySize+3)), now); s.responseConfigHistory[0].Hash != expected.Hash {
+		t.Errorf("most recent snapshot is %v, expected %v", s.responseConfigHistory[0].Content, expected.Content)
+	}
+}
@@ -0,0 +1,109 @@
+package upgraderesponder
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// watchConfigFiles polls the response config, the advisories and the request schema files and reloads the one
+// whose content changed. Comparing the content instead of the modification time also catches the symlink swap
+// done by Kubernetes when a mounted ConfigMap is updated. The response config published at an https:// URL is
+// polled with conditional requests.
+func (s *Server) watchConfigFiles(stop <-chan struct{}, interval time.Duration) {
+	responseConfigHash := s.hashResponseConfigFiles()
+	requestSchemaHash := hashFile(s.configFiles.RequestSchemaFilePath)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if s.remoteResponseConfig != nil {
+				s.pollRemoteResponseConfig()
+			}
+			if h := s.hashResponseConfigFiles(); h != "" && h != responseConfigHash {
+				responseConfigHash = h
+				if err := s.ReloadResponseConfig(); err != nil {
+					logrus.Errorf("Failed to reload response config, keep using the previous one: %v", err)
+				} else {
+					logrus.Infof("Reloaded response config %v", s.responseConfigSource())
+				}
+			}
+			if h := hashFile(s.configFiles.RequestSchemaFilePath); h != "" && h != requestSchemaHash {
+				requestSchemaHash = h
+				if err := s.ReloadRequestSchema(); err != nil {
+					logrus.Errorf("Failed to reload request schema, keep using the previous one: %v", err)
+				} else {
+					logrus.Infof("Reloaded request schema %v", s.configFiles.RequestSchemaFilePath)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// pollRemoteResponseConfig reloads the remote response config if it changed. The last good config is kept if the
+// fetch fails, which is reported by the health check.
+func (s *Server) pollRemoteResponseConfig() {
+	content, changed, err := s.remoteResponseConfig.fetch()
+	if err != nil {
+		logrus.Errorf("Failed to fetch response config, keep using the previous one: %v", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	if err := s.reloadResponseConfig(content); err != nil {
+		logrus.Errorf("Failed to reload response config, keep using the previous one: %v", err)
+	} else {
+		logrus.Infof("Reloaded response config %v", s.responseConfigSource())
+	}
+}
+
+// hashResponseConfigFiles returns the checksum of the response config file and the advisory files,
+// or an empty string if any of them cannot be read. The remote response config is polled separately.
+func (s *Server) hashResponseConfigFiles() string {
+	h := "remote"
+	if s.remoteResponseConfig == nil {
+		h = hashFile(s.configFiles.ResponseConfigFilePath)
+	}
+	if h == "" || s.configFiles.AdvisoriesDir == "" {
+		return h
+	}
+	files, err := filepath.Glob(filepath.Join(filepath.Clean(s.configFiles.AdvisoriesDir), "*.json"))
+	if err != nil {
+		logrus.Debugf("Failed to list advisory files in %v: %v", s.configFiles.AdvisoriesDir, err)
+		return ""
+	}
+	for _, file := range files {
+		fileHash := hashFile(file)
+		if fileHash == "" {
+			return ""
+		}
+		h += file + fileHash
+	}
+	return h
+}
+
+// hashFile returns the checksum of the file content or an empty string if the file cannot be read
+func hashFile(path string) string {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		logrus.Debugf("Failed to open %v for checksum: %v", path, err)
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		logrus.Debugf("Failed to read %v for checksum: %v", path, err)
+		return ""
+	}
+	return string(h.Sum(nil))
+}
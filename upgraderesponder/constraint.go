@@ -0,0 +1,101 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+
+	"github.com/longhorn/upgrade-responder/utils"
+)
+
+// matchRangeConjunction matches the whitespace between two comparisons of a range, e.g. ">=1.25 <1.30"
+var matchRangeConjunction = regexp.MustCompile(`([0-9xX*])\s+([<>=!~^])`)
+
+// parseSemverRange parses a semantic version range. Besides the syntax supported by Masterminds/semver,
+// comparisons separated by whitespace are combined with AND, e.g. ">=1.25 <1.30" is ">=1.25, <1.30".
+func parseSemverRange(r string) (*semver.Constraints, error) {
+	return semver.NewConstraint(matchRangeConjunction.ReplaceAllString(r, "${1}, ${2}"))
+}
+
+// Constraint restricts a version to the clients reporting a matching value of an extra tag.
+// In the response config, it is either a string as a semantic version range, e.g. ">=1.25 <1.30",
+// or a list of the exact values allowed, e.g. ["amd64", "arm64"].
+type Constraint struct {
+	Range  string
+	Values []string
+
+	semverRange *semver.Constraints
+}
+
+func (c *Constraint) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &c.Range); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, &c.Values); err != nil {
+		return fmt.Errorf("constraint must be either a semantic version range or a list of values: %s", b)
+	}
+	return nil
+}
+
+func (c Constraint) MarshalJSON() ([]byte, error) {
+	if c.Range != "" {
+		return json.Marshal(c.Range)
+	}
+	return json.Marshal(c.Values)
+}
+
+func (c *Constraint) validate() error {
+	if c.Range == "" {
+		if len(c.Values) == 0 {
+			return fmt.Errorf("constraint must have either a semantic version range or a list of values")
+		}
+		return nil
+	}
+	r, err := parseSemverRange(c.Range)
+	if err != nil {
+		return errors.Wrapf(err, "invalid semantic version range %v", c.Range)
+	}
+	c.semverRange = r
+	return nil
+}
+
+// Match returns whether the value reported by the client satisfies the constraint.
+// Only major, minor and patch of a version value are compared against a range, so that vendor specific
+// suffixes like v1.27.4+k3s1 or 1.27.4-eks-2d98532 don't exclude the client.
+func (c *Constraint) Match(value string) bool {
+	if c.Range == "" {
+		return utils.Contains(c.Values, value)
+	}
+	if c.semverRange == nil {
+		if err := c.validate(); err != nil {
+			return false
+		}
+	}
+	v, err := semver.NewVersion(value)
+	if err != nil {
+		return false
+	}
+	core, err := v.SetPrerelease("")
+	if err != nil {
+		return false
+	}
+	return c.semverRange.Check(&core)
+}
+
+// isCompatibleWith returns whether the client reporting the tags satisfies all constraints of the version.
+// A constraint on a tag that the client doesn't report is ignored.
+func (v *Version) isCompatibleWith(tags map[string]string) bool {
+	for key, c := range v.Constraints {
+		value, ok := tags[key]
+		if !ok {
+			continue
+		}
+		if !c.Match(value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+)
+
+func TestConstraintMatch(t *testing.T) {
+	testCases := []struct {
+		constraint string
+		value      string
+		expected   bool
+	}{
+		{constraint: `">=1.25 <1.30"`, value: "v1.27.4", expected: true},
+		{constraint: `">=1.25 <1.30"`, value: "v1.27.4+k3s1", expected: true},
+		{constraint: `">=1.25 <1.30"`, value: "1.27.4-eks-2d98532", expected: true},
+		{constraint: `">=1.25 <1.30"`, value: "v1.27.4-gke.900", expected: true},
+		{constraint: `">=1.25 <1.30"`, value: "v1.30.0", expected: false},
+		{constraint: `">=1.25 <1.30"`, value: "v1.24.9", expected: false},
+		{constraint: `">=1.25, <1.30"`, value: "v1.25.0", expected: true},
+		{constraint: `"<1.20 || >=1.25"`, value: "v1.22.0", expected: false},
+		{constraint: `"<1.20 || >=1.25"`, value: "v1.26.0", expected: true},
+		{constraint: `">=1.25"`, value: "not-a-version", expected: false},
+		{constraint: `["amd64", "arm64"]`, value: "arm64", expected: true},
+		{constraint: `["amd64", "arm64"]`, value: "s390x", expected: false},
+	}
+
+	for i, testCase := range testCases {
+		var c Constraint
+		if err := json.Unmarshal([]byte(testCase.constraint), &c); err != nil {
+			t.Fatalf("Test case %v: failed to unmarshal constraint: %v", i, err)
+		}
+		if err := c.validate(); err != nil {
+			t.Fatalf("Test case %v: invalid constraint: %v", i, err)
+		}
+		if output := c.Match(testCase.value); output != testCase.expected {
+			t.Errorf("Test case %v: %+v Output %v not equal to expected %v", i, testCase, output, testCase.expected)
+		}
+	}
+}
+
+func TestConstraintValidate(t *testing.T) {
+	testCases := []struct {
+		constraint    string
+		expectedError bool
+	}{
+		{constraint: `">=1.25 <1.30"`, expectedError: false},
+		{constraint: `["amd64"]`, expectedError: false},
+		{constraint: `"not a range"`, expectedError: true},
+		{constraint: `""`, expectedError: true},
+		{constraint: `[]`, expectedError: true},
+	}
+
+	for i, testCase := range testCases {
+		var c Constraint
+		if err := json.Unmarshal([]byte(testCase.constraint), &c); err != nil {
+			t.Fatalf("Test case %v: failed to unmarshal constraint: %v", i, err)
+		}
+		if err := c.validate(); testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: expected error %v but got %v", i, testCase.expectedError, err)
+		}
+	}
+
+	var c Constraint
+	if err := json.Unmarshal([]byte(`{"range": ">=1.25"}`), &c); err == nil {
+		t.Errorf("expected error for constraint of invalid type")
+	}
+}
+
+func TestGenerateCheckUpgradeResponseWithConstraints(t *testing.T) {
+	var versions []Version
+	if err := json.Unmarshal([]byte(`[
+		{"name": "v1.2.4", "releaseDate": "2022-03-17T00:00:00Z", "tags": ["stable"],
+		 "constraints": {"kubernetesVersion": ">=1.21"}},
+		{"name": "v1.3.0", "releaseDate": "2022-06-15T00:00:00Z", "tags": ["latest"],
+		 "constraints": {"kubernetesVersion": ">=1.25 <1.30", "arch": ["amd64", "arm64"]}}
+	]`), &versions); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, versions)
+
+	testCases := []struct {
+		extraTagInfo     map[string]string
+		expectedVersions []string
+	}{
+		{extraTagInfo: nil, expectedVersions: []string{"v1.2.4", "v1.3.0"}},
+		{extraTagInfo: map[string]string{"kubernetesVersion": "v1.27.4+k3s1", "arch": "arm64"}, expectedVersions: []string{"v1.2.4", "v1.3.0"}},
+		{extraTagInfo: map[string]string{"kubernetesVersion": "v1.27.4+k3s1", "arch": "s390x"}, expectedVersions: []string{"v1.2.4"}},
+		{extraTagInfo: map[string]string{"kubernetesVersion": "v1.22.0"}, expectedVersions: []string{"v1.2.4"}},
+		{extraTagInfo: map[string]string{"kubernetesVersion": "v1.20.0"}, expectedVersions: []string{}},
+	}
+
+	for i, testCase := range testCases {
+		resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.0", ExtraTagInfo: testCase.extraTagInfo})
+		if err != nil {
+			t.Fatalf("Test case %v: unexpected error %v", i, err)
+		}
+		names := []string{}
+		for _, v := range resp.Versions {
+			names = append(names, v.Name)
+		}
+		sort.Strings(names)
+		if !equalStrings(names, testCase.expectedVersions) {
+			t.Errorf("Test case %v: versions %v not equal to expected %v", i, names, testCase.expectedVersions)
+		}
+	}
+}
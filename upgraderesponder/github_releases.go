@@ -0,0 +1,115 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Masterminds/semver"
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ResponseConfigTypeGitHubReleases is a GitHub "list releases" JSON document converted into the response config
+	ResponseConfigTypeGitHubReleases = "github-releases"
+
+	VersionTagPrerelease = "prerelease"
+)
+
+// githubRelease is the subset of a release in the GitHub "list releases" API response used to build a Version
+type githubRelease struct {
+	TagName     string `json:"tag_name"`
+	Name        string `json:"name"`
+	Draft       bool   `json:"draft"`
+	Prerelease  bool   `json:"prerelease"`
+	PublishedAt string `json:"published_at"`
+	Body        string `json:"body"`
+	HTMLURL     string `json:"html_url"`
+}
+
+// ValidateResponseConfigType returns an error if the type of the response config is neither empty nor supported
+func ValidateResponseConfigType(configType string) error {
+	switch configType {
+	case "", ResponseConfigTypeGitHubReleases:
+		return nil
+	}
+	return fmt.Errorf("unsupported response config type %v, must be empty or %v", configType, ResponseConfigTypeGitHubReleases)
+}
+
+// LoadGitHubReleases converts the GitHub releases JSON file, or downloaded from the https:// URL, into a response config
+func LoadGitHubReleases(path string) (*ResponseConfig, error) {
+	content, err := readConfigSource(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to open GitHub releases at %v", path)
+	}
+	return ConvertGitHubReleases(content)
+}
+
+// ConvertGitHubReleases converts a GitHub "list releases" JSON document into a response config. The prereleases are
+// tagged `prerelease` and the other releases `stable`, and the highest stable release is tagged `latest` too.
+// The default channel is `stable`. The versions are sorted by semantic version, newest first.
+// The drafts and the releases not named in semantic versioning, e.g. the Helm chart releases, are skipped.
+func ConvertGitHubReleases(content []byte) (*ResponseConfig, error) {
+	var releases []githubRelease
+	if err := json.Unmarshal(content, &releases); err != nil {
+		return nil, errors.Wrap(err, "fail to decode GitHub releases")
+	}
+
+	type release struct {
+		version *Version
+		semver  *semver.Version
+	}
+	converted := []release{}
+	for _, r := range releases {
+		name := r.TagName
+		if name == "" {
+			name = r.Name
+		}
+		if r.Draft || r.PublishedAt == "" {
+			logrus.Debugf("Skip unpublished GitHub release %v", name)
+			continue
+		}
+		ver, err := semver.NewVersion(name)
+		if err != nil {
+			logrus.Debugf("Skip GitHub release %v not in semantic versioning: %v", name, err)
+			continue
+		}
+
+		v := &Version{
+			Name:        name,
+			ReleaseDate: r.PublishedAt,
+			Tags:        []string{VersionTagStable},
+			ExtraInfo:   map[string]string{},
+		}
+		// A release named like a prerelease is a prerelease even if not flagged as one
+		if r.Prerelease || ver.Prerelease() != "" {
+			v.Tags = []string{VersionTagPrerelease}
+		}
+		if r.HTMLURL != "" {
+			v.ExtraInfo["releaseNoteLink"] = r.HTMLURL
+		}
+		if r.Body != "" {
+			v.ExtraInfo["releaseNote"] = r.Body
+		}
+		converted = append(converted, release{version: v, semver: ver})
+	}
+
+	sort.Slice(converted, func(i, j int) bool {
+		return converted[i].semver.GreaterThan(converted[j].semver)
+	})
+	// The prereleases are only offered to the clients requesting them
+	config := &ResponseConfig{Versions: []Version{}, DefaultChannel: VersionTagStable}
+	tagged := false
+	for _, r := range converted {
+		if !tagged && r.version.Tags[0] == VersionTagStable {
+			r.version.Tags = append(r.version.Tags, VersionTagLatest)
+			tagged = true
+		}
+		config.Versions = append(config.Versions, *r.version)
+	}
+	if !tagged {
+		return nil, fmt.Errorf("no stable GitHub release to tag as %v", VersionTagLatest)
+	}
+	return config, nil
+}
@@ -0,0 +1,85 @@
+package upgraderesponder
+
+import (
+	"testing"
+)
+
+func TestLoadGitHubReleases(t *testing.T) {
+	config, err := LoadGitHubReleases("testdata/github/releases.json")
+	if err != nil {
+		t.Fatalf("failed to convert GitHub releases: %v", err)
+	}
+
+	expected := []struct {
+		name        string
+		releaseDate string
+		tags        []string
+	}{
+		{name: "v1.6.0-rc1", releaseDate: "2024-01-10T09:30:00Z", tags: []string{VersionTagPrerelease}},
+		{name: "v1.5.4", releaseDate: "2024-01-05T03:00:00Z", tags: []string{VersionTagStable, VersionTagLatest}},
+		{name: "v1.5.3", releaseDate: "2023-11-20T03:00:00Z", tags: []string{VersionTagStable}},
+		{name: "v1.4.5", releaseDate: "2024-01-08T03:00:00Z", tags: []string{VersionTagStable}},
+	}
+	if len(config.Versions) != len(expected) {
+		t.Fatalf("expected %v versions but got %+v", len(expected), config.Versions)
+	}
+	for i, v := range config.Versions {
+		if v.Name != expected[i].name || v.ReleaseDate != expected[i].releaseDate || !equalStrings(v.Tags, expected[i].tags) {
+			t.Errorf("Test case %v: version %+v not equal to expected %+v", i, v, expected[i])
+		}
+	}
+	if link := config.Versions[1].ExtraInfo["releaseNoteLink"]; link != "https://github.com/longhorn/longhorn/releases/tag/v1.5.4" {
+		t.Errorf("unexpected release note link %v", link)
+	}
+
+	s := &Server{
+		VersionMap:     map[string]*Version{},
+		TagVersionsMap: map[string][]*Version{},
+	}
+	if err := s.validateAndLoadResponseConfig(config); err != nil {
+		t.Errorf("invalid converted response config: %v", err)
+	}
+}
+
+func TestConvertGitHubReleases(t *testing.T) {
+	testCases := []struct {
+		content       string
+		expectedError bool
+	}{
+		{content: `[{"tag_name": "v1.0.0", "published_at": "2020-05-30T10:20:00Z"}]`, expectedError: false},
+		// The name is used if there is no tag
+		{content: `[{"name": "v1.0.0", "published_at": "2020-05-30T10:20:00Z"}]`, expectedError: false},
+		{content: `[{"tag_name": "v1.0.0-rc1", "published_at": "2020-05-30T10:20:00Z"}]`, expectedError: true},
+		{content: `[{"tag_name": "v1.0.0", "published_at": "2020-05-30T10:20:00Z", "prerelease": true}]`, expectedError: true},
+		{content: `[{"tag_name": "v1.0.0", "draft": true}]`, expectedError: true},
+		{content: `[]`, expectedError: true},
+		{content: `{}`, expectedError: true},
+	}
+	for i, testCase := range testCases {
+		if _, err := ConvertGitHubReleases([]byte(testCase.content)); testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: expected error %v but got %v", i, testCase.expectedError, err)
+		}
+	}
+}
+
+func TestGitHubReleasesResponseConfigSource(t *testing.T) {
+	s, err := NewSimulationServer(ConfigFiles{ResponseConfigFilePath: "testdata/github/releases.json", ResponseConfigType: ResponseConfigTypeGitHubReleases})
+	if err != nil {
+		t.Fatalf("failed to load GitHub releases: %v", err)
+	}
+	resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.5.3"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(resp.Versions) != 1 || resp.RecommendedVersion != "v1.5.4" {
+		t.Errorf("unexpected response %+v, expected v1.5.4 only", resp)
+	}
+
+	resp, err = s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.5.3", Channel: VersionTagPrerelease})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(resp.Versions) != 1 || resp.Versions[0].Name != "v1.6.0-rc1" {
+		t.Errorf("unexpected response %+v, expected v1.6.0-rc1 only", resp)
+	}
+}
@@ -0,0 +1,201 @@
+package upgraderesponder
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/longhorn/upgrade-responder/utils"
+)
+
+// jsonSchemaDraft is the only JSON Schema dialect translated into a request schema
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// The JSON Schema keywords which only document the schema and are ignored
+var jsonSchemaAnnotations = []string{"$schema", "$id", "$comment", "title", "description", "examples", "default"}
+
+// The types of JSON Schema translated into the data types of the request schema
+var jsonSchemaTypes = map[string]string{
+	"string":  DataTypeString,
+	"number":  DataTypeFloat,
+	"integer": DataTypeInt,
+	"boolean": DataTypeBoolean,
+}
+
+// isJSONSchema returns whether the decoded request schema document is a JSON Schema describing the request body
+// instead of a request schema. The dialect of $schema is checked by translateJSONSchema, so that a JSON Schema of
+// another draft is reported instead of being decoded as a request schema.
+func isJSONSchema(doc map[string]interface{}) bool {
+	_, hasSchema := doc["$schema"]
+	_, hasProperties := doc["properties"]
+	return hasSchema || hasProperties
+}
+
+// translateJSONSchema translates a JSON Schema (draft 2020-12 subset) describing the request body into a request
+// schema. The properties appVersion, extraTagInfo and extraFieldInfo of the request body are translated, and the
+// keywords other than type, enum, pattern, minLength, maxLength, minimum, maximum, properties and the annotations
+// are reported as unsupported.
+func translateJSONSchema(doc map[string]interface{}, lines configLines) (*RequestSchema, error) {
+	t := &jsonSchemaTranslator{lines: lines}
+	if dialect, ok := doc["$schema"]; ok && dialect != jsonSchemaDraft && dialect != jsonSchemaDraft+"#" {
+		t.fail("", "has unsupported $schema %v, only %v is supported", dialect, jsonSchemaDraft)
+	}
+	requestSchema := &RequestSchema{
+		AppVersionSchema:     Schema{DataType: DataTypeString},
+		ExtraTagInfoSchema:   map[string]Schema{},
+		ExtraFieldInfoSchema: map[string]Schema{},
+		lines:                configLines{},
+	}
+
+	properties := t.translateObject("", doc)
+	for _, name := range utils.SortedKeys(properties) {
+		path := childConfigPath("properties", name)
+		switch name {
+		case "appVersion":
+			if schema, ok := t.translateValue(path, properties[name]); ok {
+				requestSchema.AppVersionSchema = schema
+			}
+			requestSchema.lines["appVersionSchema"] = lines[path]
+		case "extraTagInfo", "extraFieldInfo":
+			schemas := requestSchema.ExtraTagInfoSchema
+			if name == "extraFieldInfo" {
+				schemas = requestSchema.ExtraFieldInfoSchema
+			}
+			object, ok := properties[name].(map[string]interface{})
+			if !ok {
+				t.fail(path, "must be an object schema")
+				continue
+			}
+			keys := t.translateObject(path, object)
+			for _, key := range utils.SortedKeys(keys) {
+				keyPath := childConfigPath(childConfigPath(path, "properties"), key)
+				if schema, ok := t.translateValue(keyPath, keys[key]); ok {
+					schemas[key] = schema
+				}
+				requestSchema.lines[joinConfigPath(name+"Schema", key)] = lines[keyPath]
+			}
+		default:
+			logrus.Debugf("Property %v of the request JSON Schema is not validated", name)
+		}
+	}
+
+	if len(t.errs) > 0 {
+		return nil, &ValidationError{Errors: t.errs}
+	}
+	return requestSchema, nil
+}
+
+type jsonSchemaTranslator struct {
+	lines configLines
+	errs  []error
+}
+
+func (t *jsonSchemaTranslator) fail(path, format string, args ...interface{}) {
+	location := path
+	if location == "" {
+		location = "the root"
+	}
+	err := fmt.Errorf("JSON Schema at %v %v", location, fmt.Sprintf(format, args...))
+	t.errs = append(t.errs, t.lines.wrap(err, path))
+}
+
+// translateObject checks the keywords of an object schema and returns its properties
+func (t *jsonSchemaTranslator) translateObject(path string, object map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for _, keyword := range utils.SortedKeys(object) {
+		value := object[keyword]
+		switch {
+		case keyword == "type":
+			if value != "object" {
+				t.fail(path, "must have type object: %v", value)
+			}
+		case keyword == "properties":
+			p, ok := value.(map[string]interface{})
+			if !ok {
+				t.fail(path, "must have an object of properties")
+				continue
+			}
+			properties = p
+		case !utils.Contains(jsonSchemaAnnotations, keyword):
+			t.fail(path, "has unsupported keyword %v", keyword)
+		}
+	}
+	return properties
+}
+
+// translateValue translates the schema of a value into the request schema
+func (t *jsonSchemaTranslator) translateValue(path string, value interface{}) (Schema, bool) {
+	var schema Schema
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		t.fail(path, "must be an object schema")
+		return schema, false
+	}
+
+	errCount := len(t.errs)
+	jsonType, ok := object["type"].(string)
+	if !ok {
+		t.fail(path, "must have a type among %v", strings.Join(utils.SortedKeys(jsonSchemaTypes), ", "))
+		return schema, false
+	}
+	if schema.DataType, ok = jsonSchemaTypes[jsonType]; !ok {
+		t.fail(path, "has unsupported type %v", jsonType)
+		return schema, false
+	}
+
+	for _, keyword := range utils.SortedKeys(object) {
+		value := object[keyword]
+		switch keyword {
+		case "type":
+		case "enum":
+			enum, ok := value.([]interface{})
+			if !ok {
+				t.fail(path, "must have an array enum")
+				continue
+			}
+			schema.Enum = enum
+		case "pattern":
+			pattern, ok := value.(string)
+			if !ok {
+				t.fail(path, "must have a string pattern")
+				continue
+			}
+			schema.Pattern = pattern
+		case "maxLength", "minLength":
+			length, ok := value.(float64)
+			if !ok || length < 0 || length != math.Trunc(length) {
+				t.fail(path, "must have a non-negative integer %v", keyword)
+				continue
+			}
+			if keyword == "maxLength" {
+				// MaxLen 0 is the default maximum length of the request schema
+				if length == 0 {
+					t.fail(path, "has unsupported maxLength 0, use enum [\"\"] to only allow the empty string")
+					continue
+				}
+				schema.MaxLen = int(length)
+			} else {
+				schema.MinLen = int(length)
+			}
+		case "minimum", "maximum":
+			limit, ok := value.(float64)
+			if !ok {
+				t.fail(path, "must have a number %v", keyword)
+				continue
+			}
+			if keyword == "minimum" {
+				schema.Min = &limit
+			} else {
+				schema.Max = &limit
+			}
+		default:
+			if !utils.Contains(jsonSchemaAnnotations, keyword) {
+				t.fail(path, "has unsupported keyword %v", keyword)
+			}
+		}
+	}
+	schema.lengthInRunes = true
+	return schema, len(t.errs) == errCount
+}
@@ -0,0 +1,175 @@
+package upgraderesponder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadJSONSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "request.schema.json")
+	content := `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"title": "Check-in request",
+	"type": "object",
+	"properties": {
+		"appVersion": {"type": "string", "maxLength": 20, "pattern": "^v"},
+		"channel": {"type": "string"},
+		"extraTagInfo": {
+			"type": "object",
+			"properties": {
+				"kubernetesVersion": {"type": "string", "pattern": "^v[0-9]+\\.[0-9]+", "description": "Kubernetes server version"},
+				"architecture": {"type": "string", "enum": ["amd64", "arm64"]},
+				"zone": {"type": "string", "minLength": 2, "maxLength": 3}
+			}
+		},
+		"extraFieldInfo": {
+			"type": "object",
+			"properties": {
+				"nodeCount": {"type": "integer", "minimum": 1, "maximum": 1000},
+				"diskUsageRatio": {"type": "number", "maximum": 1},
+				"ha": {"type": "boolean"}
+			}
+		}
+	}
+}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{configFiles: ConfigFiles{RequestSchemaFilePath: path}}
+	if err := s.ReloadRequestSchema(); err != nil {
+		t.Fatalf("failed to load JSON Schema: %v", err)
+	}
+
+	testCases := []struct {
+		key           string
+		value         interface{}
+		extraInfoType string
+		expected      bool
+	}{
+		{key: "kubernetesVersion", value: "v1.27.4", extraInfoType: extraInfoTypeTag, expected: true},
+		{key: "kubernetesVersion", value: "1.27.4", extraInfoType: extraInfoTypeTag, expected: false},
+		{key: "architecture", value: "arm64", extraInfoType: extraInfoTypeTag, expected: true},
+		{key: "architecture", value: "s390x", extraInfoType: extraInfoTypeTag, expected: false},
+		// the lengths count code points as in JSON Schema
+		{key: "zone", value: "äöü", extraInfoType: extraInfoTypeTag, expected: true},
+		{key: "zone", value: "äöüa", extraInfoType: extraInfoTypeTag, expected: false},
+		{key: "zone", value: "ä", extraInfoType: extraInfoTypeTag, expected: false},
+		{key: "channel", value: "stable", extraInfoType: extraInfoTypeTag, expected: false},
+		{key: "nodeCount", value: 3.0, extraInfoType: extraInfoTypeField, expected: true},
+		{key: "nodeCount", value: 3.5, extraInfoType: extraInfoTypeField, expected: false},
+		{key: "nodeCount", value: 0.0, extraInfoType: extraInfoTypeField, expected: false},
+		{key: "diskUsageRatio", value: 0.5, extraInfoType: extraInfoTypeField, expected: true},
+		{key: "diskUsageRatio", value: 1.5, extraInfoType: extraInfoTypeField, expected: false},
+		{key: "ha", value: true, extraInfoType: extraInfoTypeField, expected: true},
+	}
+	for i, testCase := range testCases {
+		if output := s.ValidateExtraInfo(testCase.key, testCase.value, testCase.extraInfoType); output != testCase.expected {
+			t.Errorf("Test case %v: %+v Output %v not equal to expected %v", i, testCase, output, testCase.expected)
+		}
+	}
+
+	appVersionSchema := s.RequestSchema.AppVersionSchema
+	if !appVersionSchema.Validate("v1.5.0") || appVersionSchema.Validate("1.5.0") || appVersionSchema.Validate("v1.5.0-very-long-prerelease") {
+		t.Errorf("app version schema %+v is not translated", appVersionSchema)
+	}
+}
+
+func TestJSONSchemaErrors(t *testing.T) {
+	testCases := []struct {
+		content        string
+		expectedErrors []string
+	}{
+		{
+			content: `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["appVersion"],
+	"properties": {
+		"extraTagInfo": {
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"kubernetesVersion": {"type": "string", "format": "semver"},
+				"nodeCount": {"type": "integer"},
+				"zone": {"type": ["string", "null"]},
+				"region": {"enum": ["us", "eu"]}
+			}
+		},
+		"extraFieldInfo": {
+			"type": "object",
+			"properties": {
+				"nodeCount": {"type": "integer", "exclusiveMinimum": 0},
+				"diskSize": {"type": "number", "minimum": 10, "maximum": 1},
+				"name": {"type": "string", "maxLength": -1},
+				"owner": {"type": "string", "maxLength": 0}
+			}
+		}
+	}
+}`,
+			expectedErrors: []string{
+				"JSON Schema at the root has unsupported keyword required",
+				"line 21: JSON Schema at properties.extraFieldInfo.properties.name must have a non-negative integer maxLength",
+				"line 19: JSON Schema at properties.extraFieldInfo.properties.nodeCount has unsupported keyword exclusiveMinimum",
+				"line 22: JSON Schema at properties.extraFieldInfo.properties.owner has unsupported maxLength 0, use enum [\"\"] to only allow the empty string",
+				"line 6: JSON Schema at properties.extraTagInfo has unsupported keyword additionalProperties",
+				"line 10: JSON Schema at properties.extraTagInfo.properties.kubernetesVersion has unsupported keyword format",
+				"line 13: JSON Schema at properties.extraTagInfo.properties.region must have a type among boolean, integer, number, string",
+				"line 12: JSON Schema at properties.extraTagInfo.properties.zone must have a type among boolean, integer, number, string",
+			},
+		},
+		{
+			content: `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"properties": {
+		"appVersion": {"type": "string"}
+	}
+}`,
+			expectedErrors: []string{
+				"JSON Schema at the root has unsupported $schema http://json-schema.org/draft-07/schema#, only https://json-schema.org/draft/2020-12/schema is supported",
+			},
+		},
+		{
+			// The translated schema is validated as the request schema
+			content: `{
+	"type": "object",
+	"properties": {
+		"extraTagInfo": {
+			"type": "object",
+			"properties": {
+				"nodeCount": {"type": "integer"}
+			}
+		},
+		"extraFieldInfo": {
+			"type": "object",
+			"properties": {
+				"diskSize": {"type": "number", "minimum": 10, "maximum": 1}
+			}
+		}
+	}
+}`,
+			expectedErrors: []string{
+				"line 13: field schema diskSize: must have min 10 <= max 1",
+				"line 7: tag schema nodeCount must have string data type int",
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+		path := filepath.Join(t.TempDir(), "request.schema.json")
+		if err := os.WriteFile(path, []byte(testCase.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		errs := ValidateConfigFiles(ConfigFiles{RequestSchemaFilePath: path})
+		var messages []string
+		for _, err := range errs {
+			messages = append(messages, strings.TrimPrefix(err.Error(), path+": "))
+		}
+		if strings.Join(messages, "\n") != strings.Join(testCase.expectedErrors, "\n") {
+			t.Errorf("Test case %v: errors are\n%v\nexpected\n%v", i, strings.Join(messages, "\n"), strings.Join(testCase.expectedErrors, "\n"))
+		}
+	}
+}
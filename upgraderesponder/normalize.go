@@ -0,0 +1,96 @@
+package upgraderesponder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+)
+
+const (
+	// NormalizeRuleRegex replaces the matches of the pattern by the replacement, which can refer to the capture groups,
+	// e.g. ${1}
+	NormalizeRuleRegex = "regex"
+	// NormalizeRuleSemverMajorMinor truncates a semantic version to MAJOR.MINOR, e.g. v1.27.4+k3s1 to 1.27
+	NormalizeRuleSemverMajorMinor = "semverMajorMinor"
+	// NormalizeRuleLowercase lower-cases the value
+	NormalizeRuleLowercase = "lowercase"
+	// NormalizeRuleMap replaces the value by the one it is mapped to, the values not in the mapping are kept
+	NormalizeRuleMap = "map"
+)
+
+// NormalizeRule transforms a string value of the request before it is validated and stored
+type NormalizeRule struct {
+	Type        string            `json:"type"`
+	Pattern     string            `json:"pattern,omitempty"`     // the regular expression of the regex rule
+	Replacement string            `json:"replacement,omitempty"` // the replacement of the regex rule
+	Mapping     map[string]string `json:"mapping,omitempty"`     // the mapping of the map rule
+
+	pattern *regexp.Regexp
+}
+
+// compile checks the rule and compiles its pattern
+func (r *NormalizeRule) compile() error {
+	switch r.Type {
+	case NormalizeRuleRegex:
+		if r.Pattern == "" {
+			return fmt.Errorf("%v rule must have a pattern", r.Type)
+		}
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "invalid pattern %v", r.Pattern)
+		}
+		r.pattern = pattern
+	case NormalizeRuleMap:
+		if len(r.Mapping) == 0 {
+			return fmt.Errorf("%v rule must have a mapping", r.Type)
+		}
+	case NormalizeRuleSemverMajorMinor, NormalizeRuleLowercase:
+	default:
+		return fmt.Errorf("unsupported type %v, must be %v, %v, %v or %v", r.Type,
+			NormalizeRuleRegex, NormalizeRuleSemverMajorMinor, NormalizeRuleLowercase, NormalizeRuleMap)
+	}
+	return nil
+}
+
+func (r *NormalizeRule) apply(value string) string {
+	switch r.Type {
+	case NormalizeRuleRegex:
+		pattern := r.pattern
+		if pattern == nil {
+			var err error
+			if pattern, err = regexp.Compile(r.Pattern); err != nil {
+				return value
+			}
+		}
+		return pattern.ReplaceAllString(value, r.Replacement)
+	case NormalizeRuleSemverMajorMinor:
+		// The value is kept if it is not a semantic version, so that the schema can reject it
+		v, err := semver.NewVersion(value)
+		if err != nil {
+			return value
+		}
+		return fmt.Sprintf("%v.%v", v.Major(), v.Minor())
+	case NormalizeRuleLowercase:
+		return strings.ToLower(value)
+	case NormalizeRuleMap:
+		if mapped, ok := r.Mapping[value]; ok {
+			return mapped
+		}
+	}
+	return value
+}
+
+// normalize applies the normalization rules of the schema to the value if it is a string
+func (sc *Schema) normalize(value interface{}) interface{} {
+	v, ok := value.(string)
+	if !ok {
+		return value
+	}
+	for i := range sc.Normalize {
+		v = sc.Normalize[i].apply(v)
+	}
+	return v
+}
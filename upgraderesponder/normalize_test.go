@@ -0,0 +1,178 @@
+package upgraderesponder
+
+import (
+	"testing"
+)
+
+func TestNormalizeRuleRegex(t *testing.T) {
+	rule := NormalizeRule{Type: NormalizeRuleRegex, Pattern: `^v?([0-9]+\.[0-9]+\.[0-9]+).*$`, Replacement: "v${1}"}
+	if err := rule.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{"v1.27.4+k3s1", "v1.27.4"},
+		{"1.27.4-eks-2d98532", "v1.27.4"},
+		{"v1.27.4-gke.900", "v1.27.4"},
+		{"unknown", "unknown"},
+	}
+	for i, testCase := range testCases {
+		if output := rule.apply(testCase.value); output != testCase.expected {
+			t.Errorf("Test case %v: %v normalized to %v, expected %v", i, testCase.value, output, testCase.expected)
+		}
+	}
+}
+
+func TestNormalizeRuleSemverMajorMinor(t *testing.T) {
+	rule := NormalizeRule{Type: NormalizeRuleSemverMajorMinor}
+	if err := rule.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{"v1.27.4+k3s1", "1.27"},
+		{"1.27.4-eks-2d98532", "1.27"},
+		{"v1.27.4-gke.900", "1.27"},
+		{"v1.28", "1.28"},
+		{"not-a-version", "not-a-version"},
+	}
+	for i, testCase := range testCases {
+		if output := rule.apply(testCase.value); output != testCase.expected {
+			t.Errorf("Test case %v: %v normalized to %v, expected %v", i, testCase.value, output, testCase.expected)
+		}
+	}
+}
+
+func TestNormalizeRuleLowercase(t *testing.T) {
+	rule := NormalizeRule{Type: NormalizeRuleLowercase}
+	if err := rule.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{"AMD64", "amd64"},
+		{"Arm64", "arm64"},
+		{"s390x", "s390x"},
+	}
+	for i, testCase := range testCases {
+		if output := rule.apply(testCase.value); output != testCase.expected {
+			t.Errorf("Test case %v: %v normalized to %v, expected %v", i, testCase.value, output, testCase.expected)
+		}
+	}
+}
+
+func TestNormalizeRuleMap(t *testing.T) {
+	rule := NormalizeRule{Type: NormalizeRuleMap, Mapping: map[string]string{"x86_64": "amd64", "aarch64": "arm64"}}
+	if err := rule.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{"x86_64", "amd64"},
+		{"aarch64", "arm64"},
+		{"amd64", "amd64"},
+		{"s390x", "s390x"},
+	}
+	for i, testCase := range testCases {
+		if output := rule.apply(testCase.value); output != testCase.expected {
+			t.Errorf("Test case %v: %v normalized to %v, expected %v", i, testCase.value, output, testCase.expected)
+		}
+	}
+}
+
+func TestNormalizeRuleCompile(t *testing.T) {
+	testCases := []struct {
+		rule          NormalizeRule
+		expectedError bool
+	}{
+		{rule: NormalizeRule{Type: NormalizeRuleRegex, Pattern: "^v"}, expectedError: false},
+		{rule: NormalizeRule{Type: NormalizeRuleRegex}, expectedError: true},
+		{rule: NormalizeRule{Type: NormalizeRuleRegex, Pattern: "^v["}, expectedError: true},
+		{rule: NormalizeRule{Type: NormalizeRuleMap}, expectedError: true},
+		{rule: NormalizeRule{Type: "uppercase"}, expectedError: true},
+	}
+	for i, testCase := range testCases {
+		if err := testCase.rule.compile(); testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: %+v unexpected error %v", i, testCase.rule, err)
+		}
+	}
+}
+
+func TestNormalizeExtraInfo(t *testing.T) {
+	s := &Server{}
+	if err := s.validateAndLoadRequestSchema(RequestSchema{
+		AppVersionSchema: Schema{DataType: "string"},
+		ExtraTagInfoSchema: map[string]Schema{
+			"kubernetesVersion": {
+				DataType: "string",
+				Pattern:  `^v[0-9]+\.[0-9]+$`,
+				Normalize: []NormalizeRule{
+					{Type: NormalizeRuleSemverMajorMinor},
+					{Type: NormalizeRuleRegex, Pattern: "^", Replacement: "v"},
+				},
+			},
+			"architecture": {
+				DataType: "string",
+				Enum:     []interface{}{"amd64", "arm64"},
+				Normalize: []NormalizeRule{
+					{Type: NormalizeRuleLowercase},
+					{Type: NormalizeRuleMap, Mapping: map[string]string{"x86_64": "amd64"}},
+				},
+			},
+		},
+		ExtraFieldInfoSchema: map[string]Schema{
+			"nodeCount": {DataType: "int"},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tags := s.getTagsFromRequest(&CheckUpgradeRequest{
+		AppVersion: "v1.0.0",
+		ExtraTagInfo: map[string]string{
+			"kubernetesVersion": "v1.27.4+k3s1",
+			"architecture":      "X86_64",
+		},
+	}, nil)
+	if tags["kubernetes_version"] != "v1.27" || tags["architecture"] != "amd64" {
+		t.Errorf("tags are not normalized: %v", tags)
+	}
+
+	tags = s.getTagsFromRequest(&CheckUpgradeRequest{
+		AppVersion:   "v1.0.0",
+		ExtraTagInfo: map[string]string{"kubernetesVersion": "unknown", "architecture": "s390x"},
+	}, nil)
+	if _, ok := tags["kubernetes_version"]; ok {
+		t.Errorf("invalid kubernetesVersion is stored: %v", tags)
+	}
+	if _, ok := tags["architecture"]; ok {
+		t.Errorf("invalid architecture is stored: %v", tags)
+	}
+
+	fields := s.getFieldsFromRequest(&CheckUpgradeRequest{ExtraFieldInfo: map[string]interface{}{"nodeCount": 3.0}})
+	if fields["node_count"] != 3.0 {
+		t.Errorf("fields are changed: %v", fields)
+	}
+
+	// The normalization rules are only allowed for strings
+	if err := s.validateAndLoadRequestSchema(RequestSchema{
+		AppVersionSchema: Schema{DataType: "string"},
+		ExtraFieldInfoSchema: map[string]Schema{
+			"nodeCount": {DataType: "int", Normalize: []NormalizeRule{{Type: NormalizeRuleLowercase}}},
+		},
+	}); err == nil {
+		t.Errorf("expected error for normalization rules of an int field")
+	}
+}
@@ -0,0 +1,160 @@
+package upgraderesponder
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const remoteConfigFetchTimeout = 30 * time.Second
+
+// remoteConfigSource is a config file published at an https:// URL. It is polled with conditional requests so that
+// the content is only downloaded again when it changes.
+type remoteConfigSource struct {
+	sync.Mutex
+
+	url    string
+	client *http.Client
+
+	content      []byte // the last content fetched successfully
+	etag         string
+	lastModified string
+	lastSuccess  time.Time // the last time the content was fetched or confirmed unchanged
+	lastErr      error
+}
+
+// RemoteConfigStatus reports how fresh the config fetched from a remote source is
+type RemoteConfigStatus struct {
+	URL                 string `json:"url"`
+	LastSuccessfulFetch string `json:"lastSuccessfulFetch,omitempty"`
+	StaleSeconds        int64  `json:"staleSeconds"` // since the last successful fetch
+	LastError           string `json:"lastError,omitempty"`
+}
+
+func isRemoteConfigSource(path string) bool {
+	return strings.HasPrefix(path, "https://")
+}
+
+func newRemoteConfigSource(url string) *remoteConfigSource {
+	return &remoteConfigSource{
+		url:    url,
+		client: &http.Client{Timeout: remoteConfigFetchTimeout},
+	}
+}
+
+// readConfigSource reads the config file at the path or downloads it if the path is an https:// URL
+func readConfigSource(path string) ([]byte, error) {
+	if isRemoteConfigSource(path) {
+		content, _, err := newRemoteConfigSource(path).fetch()
+		return content, err
+	}
+	return os.ReadFile(filepath.Clean(path))
+}
+
+// configSourceExt returns the file extension of the config source, ignoring the query of an URL
+func configSourceExt(path string) string {
+	if isRemoteConfigSource(path) {
+		if u, err := url.Parse(path); err == nil {
+			return filepath.Ext(u.Path)
+		}
+	}
+	return filepath.Ext(path)
+}
+
+// fetch returns the current content of the source and whether it changed since the previous fetch. The content
+// is downloaded only if it changed according to the ETag or Last-Modified of the previous response.
+func (r *remoteConfigSource) fetch() ([]byte, bool, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	changed, err := r.fetchLocked()
+	if err != nil {
+		r.lastErr = err
+		return nil, false, err
+	}
+	r.lastErr = nil
+	r.lastSuccess = timeNow()
+	return r.content, changed, nil
+}
+
+func (r *remoteConfigSource) fetchLocked() (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return false, err
+	}
+	if r.content != nil {
+		if r.etag != "" {
+			req.Header.Set(HTTPHeaderIfNoneMatch, r.etag)
+		}
+		if r.lastModified != "" {
+			req.Header.Set("If-Modified-Since", r.lastModified)
+		}
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, errors.Wrapf(err, "fail to fetch config from %v", r.redactedURL())
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if r.content == nil {
+			return false, fmt.Errorf("fail to fetch config from %v: unexpected status %v", r.redactedURL(), resp.Status)
+		}
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("fail to fetch config from %v: unexpected status %v", r.redactedURL(), resp.Status)
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, errors.Wrapf(err, "fail to read config from %v", r.redactedURL())
+	}
+	changed := r.content == nil || string(content) != string(r.content)
+	r.content = content
+	r.etag = resp.Header.Get(HTTPHeaderETag)
+	r.lastModified = resp.Header.Get("Last-Modified")
+	return changed, nil
+}
+
+func (r *remoteConfigSource) redactedURL() string {
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return r.url
+	}
+	u.RawQuery = ""
+	return u.Redacted()
+}
+
+// responseConfigSource returns the response config file path or URL without the credentials to be logged
+func (s *Server) responseConfigSource() string {
+	if s.remoteResponseConfig != nil {
+		return s.remoteResponseConfig.redactedURL()
+	}
+	return s.configFiles.ResponseConfigFilePath
+}
+
+func (r *remoteConfigSource) status(now time.Time) *RemoteConfigStatus {
+	r.Lock()
+	defer r.Unlock()
+
+	status := &RemoteConfigStatus{URL: r.redactedURL()}
+	if !r.lastSuccess.IsZero() {
+		status.LastSuccessfulFetch = r.lastSuccess.UTC().Format(time.RFC3339)
+		status.StaleSeconds = int64(now.Sub(r.lastSuccess).Seconds())
+	}
+	if r.lastErr != nil {
+		status.LastError = r.lastErr.Error()
+	}
+	return status
+}
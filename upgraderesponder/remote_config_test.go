@@ -0,0 +1,136 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRemoteResponseConfig(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now, _ := ParseTime("2022-06-15T00:00:00Z")
+	timeNow = func() time.Time { return now }
+
+	var (
+		lock        sync.Mutex
+		content     = `{"versions": [{"name": "v1.0.0", "releaseDate": "2020-05-30T10:20:00Z", "tags": ["latest"]}]}`
+		revision    = 1
+		fail        bool
+		downloads   int
+		notModified int
+	)
+	remote := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if fail {
+			http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		etag := fmt.Sprintf(`"%v"`, revision)
+		if req.Header.Get(HTTPHeaderIfNoneMatch) == etag {
+			notModified++
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		rw.Header().Set(HTTPHeaderETag, etag)
+		_, _ = rw.Write([]byte(content))
+	}))
+	defer remote.Close()
+
+	s := &Server{
+		VersionMap:           map[string]*Version{},
+		TagVersionsMap:       map[string][]*Version{},
+		configFiles:          ConfigFiles{ResponseConfigFilePath: remote.URL + "/response.json?token=secret"},
+		remoteResponseConfig: newRemoteConfigSource(remote.URL + "/response.json?token=secret"),
+	}
+	s.remoteResponseConfig.client = remote.Client()
+	if err := s.ReloadResponseConfig(); err != nil {
+		t.Fatalf("failed to load remote response config: %v", err)
+	}
+
+	latest := func() string {
+		resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v0.9.0"})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return resp.RecommendedVersion
+	}
+	if v := latest(); v != "v1.0.0" {
+		t.Fatalf("recommended version %v not equal to expected v1.0.0", v)
+	}
+
+	// The unchanged config is not downloaded again
+	s.pollRemoteResponseConfig()
+	if downloads != 1 || notModified != 1 {
+		t.Errorf("expected 1 download and 1 not modified response but got %v and %v", downloads, notModified)
+	}
+
+	lock.Lock()
+	revision++
+	content = `{"versions": [{"name": "v1.1.0", "releaseDate": "2020-06-30T10:20:00Z", "tags": ["latest"]}]}`
+	lock.Unlock()
+	s.pollRemoteResponseConfig()
+	if v := latest(); v != "v1.1.0" {
+		t.Errorf("recommended version %v not equal to expected v1.1.0 after the remote config changed", v)
+	}
+
+	// The invalid config is not loaded
+	lock.Lock()
+	revision++
+	content = `{"versions": []}`
+	lock.Unlock()
+	s.pollRemoteResponseConfig()
+	if v := latest(); v != "v1.1.0" {
+		t.Errorf("recommended version %v not equal to expected v1.1.0 after loading an invalid remote config", v)
+	}
+
+	// The last good config is kept while the remote source is unavailable, and reported as stale
+	lock.Lock()
+	fail = true
+	lock.Unlock()
+	now = now.Add(10 * time.Minute)
+	s.pollRemoteResponseConfig()
+	if v := latest(); v != "v1.1.0" {
+		t.Errorf("recommended version %v not equal to expected v1.1.0 while the remote source is unavailable", v)
+	}
+	now = now.Add(5 * time.Minute)
+
+	rw := httptest.NewRecorder()
+	s.HealthCheck(rw, httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil))
+	var health HealthStatus
+	if err := json.Unmarshal(rw.Body.Bytes(), &health); err != nil {
+		t.Fatalf("failed to decode health status %v: %v", rw.Body.String(), err)
+	}
+	status := health.RemoteResponseConfig
+	if status == nil {
+		t.Fatalf("no remote response config status in %v", rw.Body.String())
+	}
+	if status.StaleSeconds != 15*60 || status.LastError == "" || status.LastSuccessfulFetch != "2022-06-15T00:00:00Z" {
+		t.Errorf("unexpected remote response config status %+v", status)
+	}
+	if status.URL != remote.URL+"/response.json" {
+		t.Errorf("URL %v of the status not equal to expected %v", status.URL, remote.URL+"/response.json")
+	}
+}
+
+func TestConfigFormatOfRemoteSource(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "https://example.com/response.yaml?token=secret", expected: ConfigFormatYAML},
+		{path: "https://example.com/response.toml", expected: ConfigFormatTOML},
+		{path: "https://example.com/response", expected: ConfigFormatJSON},
+		{path: "/etc/upgrade-responder/response.yml", expected: ConfigFormatYAML},
+	}
+	for i, testCase := range testCases {
+		if output := configFormatOf(testCase.path, ""); output != testCase.expected {
+			t.Errorf("Test case %v: %+v Output %v not equal to expected %v", i, testCase, output, testCase.expected)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package upgraderesponder
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+)
+
+const (
+	DataTypeString  = "string"
+	DataTypeFloat   = "float"
+	DataTypeInt     = "int" // a JSON number with no fractional part
+	DataTypeBoolean = "boolean"
+)
+
+type Schema struct {
+	DataType string        `json:"dataType"`
+	MaxLen   int           `json:"maxLen"`
+	MinLen   int           `json:"minLen,omitempty"`  // the minimum length of a string
+	Pattern  string        `json:"pattern,omitempty"` // the regular expression a string must match, e.g. "^v[0-9]+\\.[0-9]+"
+	Enum     []interface{} `json:"enum,omitempty"`    // the only values allowed if not empty
+	Min      *float64      `json:"min,omitempty"`     // the minimum of a number
+	Max      *float64      `json:"max,omitempty"`     // the maximum of a number
+
+	// Normalize are the rules applied in order to a string before it is validated and stored, e.g. to reduce the
+	// cardinality of a tag
+	Normalize []NormalizeRule `json:"normalize,omitempty"`
+
+	// MaxCardinality is the maximum number of distinct values of a tag stored in the cardinality window if not zero.
+	// The other values are stored as OverflowValue, "other" by default.
+	MaxCardinality int    `json:"maxCardinality,omitempty"`
+	OverflowValue  string `json:"overflowValue,omitempty"`
+
+	pattern       *regexp.Regexp
+	lengthInRunes bool // whether MinLen and MaxLen count code points instead of bytes, as maxLength and minLength in JSON Schema
+}
+
+func (sc *Schema) Validate(value interface{}) bool {
+	return sc.violatedRule(value) == ""
+}
+
+// violatedRule returns the rule of the schema the value breaks, e.g. "maxLen 200", or an empty string if the value
+// is valid
+func (sc *Schema) violatedRule(value interface{}) (rule string) {
+	defer func() {
+		if rule != "" {
+			logrus.Debugf("validate failed: schema %+v, value %v, rule %v", sc, value, rule)
+		}
+	}()
+
+	if !sc.validateType(value) {
+		return fmt.Sprintf("dataType %v", sc.DataType)
+	}
+	if len(sc.Enum) > 0 && !sc.inEnum(value) {
+		return fmt.Sprintf("enum %v", sc.Enum)
+	}
+
+	switch sc.DataType {
+	case DataTypeString:
+		v := value.(string)
+		maxLen := defaultMaxStringValueLength
+		if sc.MaxLen > 0 {
+			maxLen = sc.MaxLen
+		}
+		length := len(v)
+		if sc.lengthInRunes {
+			length = utf8.RuneCountInString(v)
+		}
+		if length > maxLen {
+			return fmt.Sprintf("maxLen %v", maxLen)
+		}
+		if length < sc.MinLen {
+			return fmt.Sprintf("minLen %v", sc.MinLen)
+		}
+		if sc.Pattern != "" {
+			pattern := sc.pattern
+			if pattern == nil {
+				var err error
+				if pattern, err = regexp.Compile(sc.Pattern); err != nil {
+					return fmt.Sprintf("pattern %v", sc.Pattern)
+				}
+			}
+			if !pattern.MatchString(v) {
+				return fmt.Sprintf("pattern %v", sc.Pattern)
+			}
+		}
+	case DataTypeFloat, DataTypeInt:
+		v := value.(float64)
+		if sc.Min != nil && v < *sc.Min {
+			return fmt.Sprintf("min %v", *sc.Min)
+		}
+		if sc.Max != nil && v > *sc.Max {
+			return fmt.Sprintf("max %v", *sc.Max)
+		}
+	}
+	return ""
+}
+
+// validateType returns whether the value decoded from JSON has the data type of the schema
+func (sc *Schema) validateType(value interface{}) bool {
+	switch sc.DataType {
+	case DataTypeString:
+		_, ok := value.(string)
+		return ok
+	case DataTypeFloat:
+		_, ok := value.(float64)
+		return ok
+	case DataTypeInt:
+		v, ok := value.(float64)
+		return ok && v == math.Trunc(v) && !math.IsInf(v, 0)
+	case DataTypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	}
+	return false
+}
+
+func (sc *Schema) inEnum(value interface{}) bool {
+	for _, allowed := range sc.Enum {
+		if allowed == value {
+			return true
+		}
+	}
+	return false
+}
+
+// compile checks the rules of the schema against its data type and compiles its pattern. The data type itself is
+// checked by the caller since the allowed ones depend on what the schema validates.
+func (sc *Schema) compile() []error {
+	var errs []error
+	isString := sc.DataType == DataTypeString
+	isNumber := sc.DataType == DataTypeFloat || sc.DataType == DataTypeInt
+
+	if sc.MaxLen < 0 {
+		errs = append(errs, fmt.Errorf("must have maxLen >= 0"))
+	}
+	if sc.MinLen < 0 {
+		errs = append(errs, fmt.Errorf("must have minLen >= 0"))
+	}
+	if sc.MaxLen > 0 && sc.MinLen > sc.MaxLen {
+		errs = append(errs, fmt.Errorf("must have minLen %v <= maxLen %v", sc.MinLen, sc.MaxLen))
+	}
+	if !isString && (sc.MinLen != 0 || sc.Pattern != "") {
+		errs = append(errs, fmt.Errorf("minLen and pattern are only allowed with data type %v", DataTypeString))
+	}
+	if sc.Pattern != "" {
+		pattern, err := regexp.Compile(sc.Pattern)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid pattern %v", sc.Pattern))
+		}
+		sc.pattern = pattern
+	}
+
+	if !isNumber && (sc.Min != nil || sc.Max != nil) {
+		errs = append(errs, fmt.Errorf("min and max are only allowed with data type %v or %v", DataTypeFloat, DataTypeInt))
+	}
+	if sc.Min != nil && sc.Max != nil && *sc.Min > *sc.Max {
+		errs = append(errs, fmt.Errorf("must have min %v <= max %v", *sc.Min, *sc.Max))
+	}
+
+	for _, allowed := range sc.Enum {
+		if !sc.validateType(allowed) {
+			errs = append(errs, fmt.Errorf("enum value %v is not of data type %v", allowed, sc.DataType))
+		}
+	}
+
+	if !isString && len(sc.Normalize) > 0 {
+		errs = append(errs, fmt.Errorf("normalize is only allowed with data type %v", DataTypeString))
+	}
+	for i := range sc.Normalize {
+		if err := sc.Normalize[i].compile(); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid normalization rule %v", i))
+		}
+	}
+
+	if !isString && (sc.MaxCardinality != 0 || sc.OverflowValue != "") {
+		errs = append(errs, fmt.Errorf("maxCardinality and overflowValue are only allowed with data type %v", DataTypeString))
+	}
+	if sc.MaxCardinality < 0 {
+		errs = append(errs, fmt.Errorf("must have maxCardinality >= 0"))
+	}
+	return errs
+}
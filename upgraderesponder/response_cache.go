@@ -0,0 +1,131 @@
+package upgraderesponder
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/Sirupsen/logrus"
+)
+
+// responseCache holds the responses precomputed for the app versions in the response config. The responses only
+// depend on the time through the publish and end of life dates, so they are valid between the two of these dates
+// surrounding the time they were built at.
+type responseCache struct {
+	responses  map[string]*CheckUpgradeResponse // keyed by channel and app version
+	validFrom  time.Time
+	validUntil time.Time // zero if no date after validFrom
+}
+
+func responseCacheKey(channel, appVersion string) string {
+	return channel + "/" + appVersion
+}
+
+func (c *responseCache) isValidAt(now time.Time) bool {
+	return !now.Before(c.validFrom) && (c.validUntil.IsZero() || now.Before(c.validUntil))
+}
+
+// sortVersions sorts the loaded versions by semantic version, newest first
+func (s *Server) sortVersions() error {
+	s.versions = make([]*Version, 0, len(s.VersionMap))
+	for _, v := range s.VersionMap {
+		ver, err := semver.NewVersion(v.Name)
+		if err != nil {
+			return err
+		}
+		v.semver = ver
+		s.versions = append(s.versions, v)
+	}
+	sort.Slice(s.versions, func(i, j int) bool {
+		return s.versions[i].semver.GreaterThan(s.versions[j].semver)
+	})
+	return nil
+}
+
+// isResponseCacheable returns whether the responses only depend on the app version and the channel of the request.
+// The versions with constraints or a staged rollout are offered depending on the client, so the responses have to
+// be generated for each request.
+func (s *Server) isResponseCacheable() bool {
+	for _, v := range s.versions {
+		if len(v.Constraints) > 0 || len(v.Rollout) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// buildResponseCache precomputes the response of each app version in the response config for each channel at the
+// time now. It returns nil if the responses depend on the client.
+func (s *Server) buildResponseCache(now time.Time) *responseCache {
+	if !s.isResponseCacheable() {
+		return nil
+	}
+
+	cache := &responseCache{responses: map[string]*CheckUpgradeResponse{}}
+	for _, v := range s.versions {
+		for _, t := range []string{v.PublishAt, v.EndOfLifeDate} {
+			if t == "" {
+				continue
+			}
+			ts, err := ParseTime(t)
+			if err != nil {
+				continue
+			}
+			cache.addBoundary(ts, now)
+			if t == v.EndOfLifeDate && v.SupportStatus == "" {
+				cache.addBoundary(ts.Add(-s.eolWarning), now)
+			}
+		}
+	}
+
+	channels := append([]string{""}, s.channels...)
+	for _, channel := range channels {
+		if channel != "" && len(s.TagVersionsMap[channel]) == 0 {
+			continue
+		}
+		for _, v := range s.versions {
+			request := &CheckUpgradeRequest{AppVersion: v.Name, Channel: channel}
+			resp, err := s.generateCheckUpgradeResponse(request, now)
+			if err != nil {
+				logrus.Debugf("Failed to precompute the response of version %v in channel %v: %v", v.Name, channel, err)
+				continue
+			}
+			cache.responses[responseCacheKey(channel, v.Name)] = resp
+		}
+	}
+	return cache
+}
+
+// addBoundary narrows the validity period of the cache built at the time now to exclude the time t
+func (c *responseCache) addBoundary(t, now time.Time) {
+	if t.After(now) {
+		if c.validUntil.IsZero() || t.Before(c.validUntil) {
+			c.validUntil = t
+		}
+	} else if t.After(c.validFrom) {
+		c.validFrom = t
+	}
+}
+
+// getCachedResponse returns a copy of the precomputed response of the request if it is valid at the time now.
+// The expired cache is rebuilt for the current time. The caller must hold the read lock.
+func (s *Server) getCachedResponse(request *CheckUpgradeRequest, now time.Time) *CheckUpgradeResponse {
+	cache := s.responseCache.Load()
+	if cache == nil {
+		return nil
+	}
+	if !cache.isValidAt(now) {
+		newCache := s.buildResponseCache(now)
+		if newCache == nil {
+			return nil
+		}
+		s.responseCache.CompareAndSwap(cache, newCache)
+		cache = newCache
+	}
+	cached := cache.responses[responseCacheKey(request.Channel, request.AppVersion)]
+	if cached == nil {
+		return nil
+	}
+	resp := *cached
+	return &resp
+}
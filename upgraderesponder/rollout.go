@@ -0,0 +1,94 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/longhorn/upgrade-responder/utils"
+)
+
+// timeNow is the server clock, replaced in tests
+var timeNow = time.Now
+
+// RolloutStage offers the version to Percentage percent of the clients from StartTime on
+type RolloutStage struct {
+	StartTime  string `json:"startTime"`
+	Percentage int    `json:"percentage"`
+}
+
+func validateRollout(rollout []RolloutStage) error {
+	var prev *RolloutStage
+	var prevStart time.Time
+	for i := range rollout {
+		stage := &rollout[i]
+		start, err := ParseTime(stage.StartTime)
+		if err != nil {
+			return errors.Wrapf(err, "invalid start time of rollout stage %v", i)
+		}
+		if stage.Percentage < 0 || stage.Percentage > 100 {
+			return fmt.Errorf("invalid percentage %v of rollout stage %v: must be between 0 and 100", stage.Percentage, i)
+		}
+		if prev != nil {
+			if !start.After(prevStart) {
+				return fmt.Errorf("invalid start time %v of rollout stage %v: must be after the previous stage", stage.StartTime, i)
+			}
+			if stage.Percentage < prev.Percentage {
+				return fmt.Errorf("invalid percentage %v of rollout stage %v: must not be lower than the previous stage", stage.Percentage, i)
+			}
+		}
+		prev, prevStart = stage, start
+	}
+	return nil
+}
+
+// rolloutPercentage returns the percentage of the clients the version is offered to at the time now
+func (v *Version) rolloutPercentage(now time.Time) int {
+	if len(v.Rollout) == 0 {
+		return 100
+	}
+	percentage := 0
+	for _, stage := range v.Rollout {
+		start, err := ParseTime(stage.StartTime)
+		if err != nil || start.After(now) {
+			break
+		}
+		percentage = stage.Percentage
+	}
+	return percentage
+}
+
+// isRolledOutTo returns whether the client identified by clientID is in the cohort the version is offered to.
+// The client keeps the same cohort as long as its ID doesn't change, and a different cohort is picked for each version.
+func (v *Version) isRolledOutTo(clientID string, now time.Time) bool {
+	percentage := v.rolloutPercentage(now)
+	if percentage >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(v.Name + "/" + clientID))
+	return int(h.Sum32()%100) < percentage
+}
+
+// rolloutClientID returns the ID used to pick the rollout cohort of the client. It is the anonymous instance ID
+// if provided by the client, otherwise derived from the app version and the extra tags which don't change between
+// the requests of the same instance unlike the extra fields.
+func (req *CheckUpgradeRequest) rolloutClientID() string {
+	if req.InstanceID != "" {
+		return req.InstanceID
+	}
+	id, err := json.Marshal(struct {
+		AppVersion   string
+		ExtraTagInfo map[string]string
+	}{
+		AppVersion:   req.AppVersion,
+		ExtraTagInfo: utils.MergeStringMaps(req.ExtraInfo, req.ExtraTagInfo),
+	})
+	if err != nil {
+		return req.AppVersion
+	}
+	return string(id)
+}
@@ -0,0 +1,265 @@
+package upgraderesponder
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidateRollout(t *testing.T) {
+	testCases := []struct {
+		rollout       []RolloutStage
+		expectedError bool
+	}{
+		{rollout: nil, expectedError: false},
+		{
+			rollout: []RolloutStage{
+				{StartTime: "2022-06-15T00:00:00Z", Percentage: 5},
+				{StartTime: "2022-06-17T00:00:00Z", Percentage: 25},
+				{StartTime: "2022-06-21T00:00:00Z", Percentage: 100},
+			},
+			expectedError: false,
+		},
+		{rollout: []RolloutStage{{StartTime: "invalid", Percentage: 5}}, expectedError: true},
+		{rollout: []RolloutStage{{StartTime: "2022-06-15T00:00:00Z", Percentage: 101}}, expectedError: true},
+		{rollout: []RolloutStage{{StartTime: "2022-06-15T00:00:00Z", Percentage: -1}}, expectedError: true},
+		{
+			rollout: []RolloutStage{
+				{StartTime: "2022-06-17T00:00:00Z", Percentage: 5},
+				{StartTime: "2022-06-15T00:00:00Z", Percentage: 25},
+			},
+			expectedError: true,
+		},
+		{
+			rollout: []RolloutStage{
+				{StartTime: "2022-06-15T00:00:00Z", Percentage: 25},
+				{StartTime: "2022-06-17T00:00:00Z", Percentage: 5},
+			},
+			expectedError: true,
+		},
+	}
+
+	for i, testCase := range testCases {
+		if err := validateRollout(testCase.rollout); testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: expected error %v but got %v", i, testCase.expectedError, err)
+		}
+	}
+}
+
+func TestRolloutPercentage(t *testing.T) {
+	v := &Version{
+		Name: "v1.3.0",
+		Rollout: []RolloutStage{
+			{StartTime: "2022-06-15T00:00:00Z", Percentage: 5},
+			{StartTime: "2022-06-17T00:00:00Z", Percentage: 25},
+			{StartTime: "2022-06-21T00:00:00Z", Percentage: 100},
+		},
+	}
+
+	testCases := []struct {
+		now      string
+		expected int
+	}{
+		{now: "2022-06-14T23:59:59Z", expected: 0},
+		{now: "2022-06-15T00:00:00Z", expected: 5},
+		{now: "2022-06-18T00:00:00Z", expected: 25},
+		{now: "2022-07-01T00:00:00Z", expected: 100},
+	}
+
+	for i, testCase := range testCases {
+		now, _ := ParseTime(testCase.now)
+		if output := v.rolloutPercentage(now); output != testCase.expected {
+			t.Errorf("Test case %v: %+v Output %v not equal to expected %v", i, testCase, output, testCase.expected)
+		}
+	}
+
+	if output := (&Version{Name: "v1.2.0"}).rolloutPercentage(time.Now()); output != 100 {
+		t.Errorf("version without rollout must be offered to all clients, got %v", output)
+	}
+}
+
+func TestIsRolledOutTo(t *testing.T) {
+	v := &Version{
+		Name:    "v1.3.0",
+		Rollout: []RolloutStage{{StartTime: "2022-06-15T00:00:00Z", Percentage: 0}},
+	}
+	now, _ := ParseTime("2022-06-18T00:00:00Z")
+
+	count := func(percentage int) (int, map[string]bool) {
+		v.Rollout[0].Percentage = percentage
+		cohort := map[string]bool{}
+		for i := 0; i < 10000; i++ {
+			id := fmt.Sprintf("instance-%v", i)
+			if v.isRolledOutTo(id, now) {
+				cohort[id] = true
+			}
+		}
+		return len(cohort), cohort
+	}
+
+	if n, _ := count(0); n != 0 {
+		t.Errorf("expected no client at 0%%, got %v", n)
+	}
+	if n, _ := count(100); n != 10000 {
+		t.Errorf("expected all clients at 100%%, got %v", n)
+	}
+
+	n5, cohort5 := count(5)
+	if n5 < 400 || n5 > 600 {
+		t.Errorf("expected about 500 clients at 5%%, got %v", n5)
+	}
+	n25, cohort25 := count(25)
+	if n25 < 2250 || n25 > 2750 {
+		t.Errorf("expected about 2500 clients at 25%%, got %v", n25)
+	}
+	// The cohort only grows so that no client flips back to the previous version
+	for id := range cohort5 {
+		if !cohort25[id] {
+			t.Errorf("client %v in the 5%% cohort is not in the 25%% cohort", id)
+		}
+	}
+
+	// The same client stays in the same cohort
+	req := &CheckUpgradeRequest{AppVersion: "v1.2.0", ExtraTagInfo: map[string]string{"kubernetesVersion": "v1.27.4"}, ExtraFieldInfo: map[string]interface{}{"nodeCount": 3.0}}
+	id := req.rolloutClientID()
+	req.ExtraFieldInfo["nodeCount"] = 4.0
+	if req.rolloutClientID() != id {
+		t.Errorf("client ID changed with extra fields")
+	}
+	req.InstanceID = "instance-1"
+	if req.rolloutClientID() != "instance-1" {
+		t.Errorf("client ID must be the instance ID if provided")
+	}
+}
+
+func TestGenerateCheckUpgradeResponseWithRollout(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+
+	s := newTestServer(t, []Version{
+		{Name: "v1.2.4", ReleaseDate: "2022-03-17T00:00:00Z", Tags: []string{"stable"}},
+		{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest"}, Rollout: []RolloutStage{
+			{StartTime: "2022-06-15T00:00:00Z", Percentage: 50},
+			{StartTime: "2022-06-21T00:00:00Z", Percentage: 100},
+		}},
+	})
+
+	offered := func(now, instanceID string) bool {
+		timeNow = func() time.Time {
+			ts, _ := ParseTime(now)
+			return ts
+		}
+		resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.4", InstanceID: instanceID})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return len(resp.Versions) == 1
+	}
+
+	inCohort, outOfCohort := 0, 0
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("instance-%v", i)
+		if offered("2022-06-14T00:00:00Z", id) {
+			t.Errorf("version offered to %v before the rollout", id)
+		}
+		first := offered("2022-06-16T00:00:00Z", id)
+		if first {
+			inCohort++
+		} else {
+			outOfCohort++
+		}
+		if offered("2022-06-17T00:00:00Z", id) != first {
+			t.Errorf("client %v flipped between versions", id)
+		}
+		if !offered("2022-06-22T00:00:00Z", id) {
+			t.Errorf("version not offered to %v after the rollout", id)
+		}
+	}
+	if inCohort == 0 || outOfCohort == 0 {
+		t.Errorf("expected clients both in and out of the 50%% cohort, got %v and %v", inCohort, outOfCohort)
+	}
+}
+
+func TestUpgradePathOutsideRolloutCohort(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now, _ := ParseTime("2022-06-16T00:00:00Z")
+	timeNow = func() time.Time { return now }
+
+	// The latest tag moved to v1.3.0, which is only rolled out to 5% of the clients
+	s := newTestServer(t, []Version{
+		{Name: "v1.2.4", ReleaseDate: "2022-03-17T00:00:00Z", Tags: []string{"stable"}},
+		{Name: "v1.2.5", ReleaseDate: "2022-05-17T00:00:00Z", Tags: []string{"stable"}},
+		{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest"}, Rollout: []RolloutStage{
+			{StartTime: "2022-06-15T00:00:00Z", Percentage: 5},
+		}},
+	})
+
+	inCohort, outOfCohort := 0, 0
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("instance-%v", i)
+		resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.0", InstanceID: id})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		expectedLatest := "v1.2.5"
+		if s.VersionMap["v1.3.0"].isRolledOutTo(id, now) {
+			expectedLatest = "v1.3.0"
+			inCohort++
+		} else {
+			outOfCohort++
+		}
+		if n := len(resp.UpgradePath); n == 0 || resp.UpgradePath[n-1] != expectedLatest {
+			t.Errorf("Test case %v: upgrade path is %v, expected to lead to %v", i, resp.UpgradePath, expectedLatest)
+		}
+		if resp.RecommendedVersion != expectedLatest {
+			t.Errorf("Test case %v: recommended version is %v, expected %v", i, resp.RecommendedVersion, expectedLatest)
+		}
+	}
+	if inCohort == 0 || outOfCohort == 0 {
+		t.Errorf("expected clients both in and out of the 5%% cohort, got %v and %v", inCohort, outOfCohort)
+	}
+
+	// No fallback for a client already running the newest version rolled out to all clients
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("instance-%v", i)
+		if s.VersionMap["v1.3.0"].isRolledOutTo(id, now) {
+			continue
+		}
+		resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.5", InstanceID: id})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if len(resp.UpgradePath) != 0 {
+			t.Errorf("Test case %v: upgrade path is %v, expected empty", i, resp.UpgradePath)
+		}
+	}
+
+	// The fallback is the newest latest or stable version, not a prerelease rolled out to all clients
+	s = newTestServer(t, []Version{
+		{Name: "v1.2.4", ReleaseDate: "2022-03-17T00:00:00Z", Tags: []string{"stable"}},
+		{Name: "v1.3.0-rc1", ReleaseDate: "2022-05-17T00:00:00Z", Tags: []string{VersionTagPrerelease}},
+		{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest", "stable"}, Rollout: []RolloutStage{
+			{StartTime: "2022-06-15T00:00:00Z", Percentage: 1},
+		}},
+	})
+	outOfCohort = 0
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("instance-%v", i)
+		if s.VersionMap["v1.3.0"].isRolledOutTo(id, now) {
+			continue
+		}
+		outOfCohort++
+		resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.0", InstanceID: id})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !equalStrings(resp.UpgradePath, []string{"v1.2.4"}) {
+			t.Errorf("Test case %v: upgrade path is %v, expected [v1.2.4]", i, resp.UpgradePath)
+		}
+		if resp.RecommendedVersion != "v1.2.4" {
+			t.Errorf("Test case %v: recommended version is %v, expected v1.2.4", i, resp.RecommendedVersion)
+		}
+	}
+	if outOfCohort == 0 {
+		t.Errorf("expected clients out of the 1%% cohort")
+	}
+}
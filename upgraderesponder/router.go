@@ -10,5 +10,16 @@ func NewRouter(s *Server) *mux.Router {
 	r.Methods("POST").Path("/v1/checkupgrade").HandlerFunc(s.CheckUpgrade)
 	r.Methods("GET").Path("/v1/healthcheck").HandlerFunc(s.HealthCheck)
 
+	if len(s.adminTokens) > 0 {
+		r.Methods("GET").Path("/v1/admin/versions").HandlerFunc(s.adminHandler(s.AdminListVersions))
+		r.Methods("POST").Path("/v1/admin/versions").HandlerFunc(s.adminHandler(s.AdminAddVersion))
+		r.Methods("PUT").Path("/v1/admin/versions/{name}").HandlerFunc(s.adminHandler(s.AdminUpdateVersion))
+		r.Methods("DELETE").Path("/v1/admin/versions/{name}").HandlerFunc(s.adminHandler(s.AdminDeleteVersion))
+		r.Methods("PUT").Path("/v1/admin/latest").HandlerFunc(s.adminHandler(s.AdminSetLatest))
+		r.Methods("GET").Path("/v1/admin/history").HandlerFunc(s.adminHandler(s.AdminListHistory))
+		r.Methods("GET").Path("/v1/admin/history/{hash}").HandlerFunc(s.adminHandler(s.AdminGetHistory))
+		r.Methods("POST").Path("/v1/admin/rollback").HandlerFunc(s.adminHandler(s.AdminRollback))
+	}
+
 	return r
 }
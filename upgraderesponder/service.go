@@ -1,12 +1,17 @@
 package upgraderesponder
 
 import (
+	"crypto/ed25519"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Masterminds/semver"
@@ -22,14 +27,22 @@ const (
 	VersionTagLatest  = "latest"
 	AppMinimalVersion = "v0.0.1"
 
-	InfluxDBMeasurement              = "upgrade_request"
-	InfluxDBMeasurementDownSampling  = "upgrade_request_down_sampling"
-	InfluxDBMeasurementByAppVersion  = "by_app_version_down_sampling"
-	InfluxDBMeasurementByCountryCode = "by_country_code_down_sampling"
+	InfluxDBMeasurement                = "upgrade_request"
+	InfluxDBMeasurementDownSampling    = "upgrade_request_down_sampling"
+	InfluxDBMeasurementByAppVersion    = "by_app_version_down_sampling"
+	InfluxDBMeasurementByCountryCode   = "by_country_code_down_sampling"
+	InfluxDBMeasurementBySupportStatus = "by_support_status_down_sampling"
 
-	InfluxDBContinuousQueryDownSampling  = "cq_upgrade_request_down_sampling"
-	InfluxDBContinuousQueryByAppVersion  = "cq_by_app_version_down_sampling"
-	InfluxDBContinuousQueryByCountryCode = "cq_by_country_code_down_sampling"
+	InfluxDBContinuousQueryDownSampling    = "cq_upgrade_request_down_sampling"
+	InfluxDBContinuousQueryByAppVersion    = "cq_by_app_version_down_sampling"
+	InfluxDBContinuousQueryByCountryCode   = "cq_by_country_code_down_sampling"
+	InfluxDBContinuousQueryBySupportStatus = "cq_by_support_status_down_sampling"
+
+	SupportStatusSupported  = "supported"
+	SupportStatusNearingEOL = "nearing-eol"
+	SupportStatusEOL        = "eol"
+
+	defaultEndOfLifeWarningDays = 90
 
 	influxClientTimeOut = 10 * time.Second
 )
@@ -44,8 +57,11 @@ var (
 	InfluxDBTagLocationCity           = "city"
 	InfluxDBTagLocationCountry        = "country"
 	InfluxDBTagLocationCountryISOCode = "country_isocode"
+	InfluxDBTagSupportStatus          = "support_status"
 
 	HTTPHeaderXForwardedFor = "X-Forwarded-For"
+	HTTPHeaderETag          = "ETag"
+	HTTPHeaderIfNoneMatch   = "If-None-Match"
 	ValueFieldKey           = "value" // A dummy InfluxDB field used to count the number of points
 	ValueFieldValue         = 1
 
@@ -56,6 +72,9 @@ var (
 )
 
 type Server struct {
+	// protects the loaded response config and request schema which are swapped on config reload
+	sync.RWMutex
+
 	done           chan struct{}
 	VersionMap     map[string]*Version
 	TagVersionsMap map[string][]*Version
@@ -64,6 +83,32 @@ type Server struct {
 	dbCache        *DBCache
 	RequestSchema  RequestSchema
 	scarfService   *ScarfService
+	channels       []string
+	defaultChannel string
+	advisories     []*Advisory
+	eolWarning     time.Duration
+	versions       []*Version // sorted by semantic version, newest first
+	responseCache  atomic.Pointer[responseCache]
+	signingKey     ed25519.PrivateKey
+	strictMode     string // reports or rejects the requests violating the request schema if not empty
+
+	configFiles          ConfigFiles
+	remoteResponseConfig *remoteConfigSource // polled instead of the file if the response config is an https:// URL
+
+	responseConfig        *ConfigSnapshot   // the content of the response config in use
+	responseConfigHistory []*ConfigSnapshot // the previous response configs, newest first
+
+	// serializes the changes made through the admin API
+	adminLock         sync.Mutex
+	adminTokens       map[string]string // the names of the admin API users by their tokens
+	changeLogFilePath string
+
+	configHistoryFilePath string     // the file the config history is persisted to if not empty
+	configHistoryLock     sync.Mutex // serializes the writes of the config history file
+
+	cardinalityGuard *cardinalityGuard // limits the distinct values of the tags with maxCardinality
+
+	stopped sync.WaitGroup // the background tasks saving state when done is closed
 }
 
 type Location struct {
@@ -76,80 +121,81 @@ type Location struct {
 
 type ResponseConfig struct {
 	Versions []Version `json:"versions"`
+
+	// Channels are the tags the clients are allowed to request. Any tag can be requested if empty
+	Channels []string `json:"channels,omitempty"`
+	// DefaultChannel is the channel used if the client doesn't request one. All versions are responded if empty
+	DefaultChannel string `json:"defaultChannel,omitempty"`
+
+	// Advisories are reported to the clients running an affected version
+	Advisories []Advisory `json:"advisories,omitempty"`
+
+	// EndOfLifeWarningDays is how many days before its end of life a version is reported as nearing EOL, 90 by default
+	EndOfLifeWarningDays int `json:"endOfLifeWarningDays,omitempty"`
+
+	lines configLines
 }
 
 type Version struct {
-	Name                 string            `json:"name"` // must be in semantic versioning
-	ReleaseDate          string            `json:"releaseDate"`
-	MinUpgradableVersion string            `json:"minUpgradableVersion"` // can be empty or semantic versioning
-	Tags                 []string          `json:"tags"`
-	ExtraInfo            map[string]string `json:"extraInfo"`
+	Name                 string                 `json:"name"` // must be in semantic versioning
+	ReleaseDate          string                 `json:"releaseDate"`
+	MinUpgradableVersion string                 `json:"minUpgradableVersion"` // can be empty or semantic versioning
+	Tags                 []string               `json:"tags"`
+	ExtraInfo            map[string]string      `json:"extraInfo"`
+	Constraints          map[string]*Constraint `json:"constraints,omitempty"` // only offered to the clients whose extra tags satisfy all constraints
+	Rollout              []RolloutStage         `json:"rollout,omitempty"`     // only offered to a growing percentage of the clients over time
+	Retracted            *Retraction            `json:"retracted,omitempty"`   // never offered, the clients running it are asked to upgrade urgently
+	EndOfLifeDate        string                 `json:"endOfLifeDate,omitempty"`
+	SupportStatus        string                 `json:"supportStatus,omitempty"` // overrides the status derived from EndOfLifeDate
+	PublishAt            string                 `json:"publishAt,omitempty"`     // the version is invisible until this time
+
+	semver *semver.Version
+}
+
+type Retraction struct {
+	Reason             string `json:"reason"`
+	ReplacementVersion string `json:"replacementVersion,omitempty"` // the version to move to from the retracted one
 }
 
 type RequestSchema struct {
 	AppVersionSchema     Schema            `json:"appVersionSchema"`
 	ExtraTagInfoSchema   map[string]Schema `json:"extraTagInfoSchema"`
 	ExtraFieldInfoSchema map[string]Schema `json:"extraFieldInfoSchema"`
-}
 
-type Schema struct {
-	DataType string `json:"dataType"`
-	MaxLen   int    `json:"maxLen"`
+	lines configLines
 }
 
-func (sc *Schema) Validate(value interface{}) (isValid bool) {
-	defer func() {
-		if !isValid {
-			logrus.Debugf("validate failed: schema %+v, value %v", sc, value)
-		}
-	}()
-
-	switch sc.DataType {
-	case "string":
-		v, ok := value.(string)
-		if !ok {
-			return false
-		}
-		maxLen := defaultMaxStringValueLength
-		if sc.MaxLen > 0 {
-			maxLen = sc.MaxLen
-		}
-		return len(v) <= maxLen
-	case "float":
-		if _, ok := value.(float64); !ok {
-			return false
-		}
-		return true
-	case "boolean":
-		if _, ok := value.(bool); !ok {
-			return false
-		}
-		return true
-	}
-	return false
+func (s *Server) ValidateExtraInfo(key string, value interface{}, extraInfoType string) bool {
+	_, isValid := s.normalizeExtraInfo(key, value, extraInfoType)
+	return isValid
 }
 
-func (s *Server) ValidateExtraInfo(key string, value interface{}, extraInfoType string) bool {
+// normalizeExtraInfo returns the value normalized by the rules of its schema and whether the normalized value is valid
+func (s *Server) normalizeExtraInfo(key string, value interface{}, extraInfoType string) (interface{}, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var schemas map[string]Schema
 	switch extraInfoType {
 	case extraInfoTypeTag:
-		schema, ok := s.RequestSchema.ExtraTagInfoSchema[key]
-		if !ok {
-			return false
-		}
-		return schema.Validate(value)
+		schemas = s.RequestSchema.ExtraTagInfoSchema
 	case extraInfoTypeField:
-		schema, ok := s.RequestSchema.ExtraFieldInfoSchema[key]
-		if !ok {
-			return false
-		}
-		return schema.Validate(value)
+		schemas = s.RequestSchema.ExtraFieldInfoSchema
 	default:
-		return false
+		return value, false
+	}
+	schema, ok := schemas[key]
+	if !ok {
+		return value, false
 	}
+	value = schema.normalize(value)
+	return value, schema.Validate(value)
 }
 
 type CheckUpgradeRequest struct {
 	AppVersion string `json:"appVersion"`
+	Channel    string `json:"channel,omitempty"`    // only respond the versions with this tag
+	InstanceID string `json:"instanceId,omitempty"` // anonymous ID of the instance for staged rollout, never stored
 
 	ExtraTagInfo   map[string]string      `json:"extraTagInfo"`
 	ExtraFieldInfo map[string]interface{} `json:"extraFieldInfo"`
@@ -159,67 +205,133 @@ type CheckUpgradeRequest struct {
 }
 
 type CheckUpgradeResponse struct {
-	Versions                 []Version `json:"versions"`
-	RequestIntervalInMinutes int       `json:"requestIntervalInMinutes"`
+	Versions                 []ResponseVersion `json:"versions"`
+	RecommendedVersion       string            `json:"recommendedVersion,omitempty"`
+	Urgent                   bool              `json:"urgent,omitempty"`        // the requester should upgrade as soon as possible
+	Message                  string            `json:"message,omitempty"`       // why the requester should upgrade urgently
+	Advisories               []Advisory        `json:"advisories,omitempty"`    // security advisories affecting the version of the requester
+	SupportStatus            string            `json:"supportStatus,omitempty"` // support status of the version of the requester
+	UpgradePath              []string          `json:"upgradePath,omitempty"`   // versions to upgrade to one after another to reach the latest version
+	Violations               []Violation       `json:"violations,omitempty"`    // values of the request dropped in the strict report mode
+	RequestIntervalInMinutes int               `json:"requestIntervalInMinutes"`
 }
 
-func NewServer(done chan struct{}, applicationName, responseConfigFilePath, requestSchemaFilePath, influxURL, influxUser, influxPass, queryPeriod, geodb string, cacheSyncInterval, cacheSize int, scarfEndpoint string, scarfTimeout int) (*Server, error) {
-	InfluxDBDatabase = applicationName + "_" + InfluxDBDatabase
-	InfluxDBContinuousQueryPeriod = queryPeriod
-
-	responseConfigFile, err := os.Open(filepath.Clean(responseConfigFilePath))
-	if err != nil {
-		return nil, errors.Wrapf(err, "fail to open responseConfigFile at %v", responseConfigFilePath)
-	}
-	defer responseConfigFile.Close()
+// ResponseVersion is a version newer than the one of the requester
+type ResponseVersion struct {
+	Version
+	Upgradable bool `json:"upgradable"` // whether the requester can upgrade to this version directly
+}
 
-	var config ResponseConfig
-	if err := json.NewDecoder(responseConfigFile).Decode(&config); err != nil {
-		return nil, err
-	}
+// ConfigFiles are the configuration files of the server and how to decode them
+type ConfigFiles struct {
+	ResponseConfigFilePath string // the response config file, or its https:// URL
+	RequestSchemaFilePath  string
+	AdvisoriesDir          string // the directory of the OSV advisory files added to the response config if not empty
+	AdvisoriesPackage      string // the OSV package name of the application the advisories are filtered on
+	ConfigFormat           string // json, yaml or toml, guessed from the file extensions if empty
+	ResponseConfigType     string // github-releases to convert a GitHub "list releases" document, or empty
+}
 
-	requestSchemaFile, err := os.Open(filepath.Clean(requestSchemaFilePath))
-	if err != nil {
-		return nil, errors.Wrapf(err, "fail to open requestSchemaFile at %v", requestSchemaFilePath)
-	}
-	defer requestSchemaFile.Close()
+// ServerOptions are the settings of the server, set from the command line flags
+type ServerOptions struct {
+	ConfigFiles
+
+	ApplicationName      string
+	InfluxURL            string
+	InfluxUser           string
+	InfluxPass           string
+	QueryPeriod          string
+	GeoDB                string
+	CacheSyncInterval    int // in seconds
+	CacheSize            int
+	ScarfEndpoint        string
+	ScarfTimeout         int // in seconds
+	ConfigReloadInterval int // in seconds, the files are not watched if 0
+	SigningKeyFile       string
+	AdminTokens          []string
+	ChangeLogFilePath    string
+	StrictMode           string
+	CardinalityWindow    string
+	CardinalityStateFile string
+}
 
-	var requestSchema RequestSchema
-	if err := json.NewDecoder(requestSchemaFile).Decode(&requestSchema); err != nil {
-		return nil, err
-	}
+func NewServer(done chan struct{}, opts ServerOptions) (*Server, error) {
+	InfluxDBDatabase = opts.ApplicationName + "_" + InfluxDBDatabase
+	InfluxDBContinuousQueryPeriod = opts.QueryPeriod
 
 	s := &Server{
 		done:           done,
 		VersionMap:     map[string]*Version{},
 		TagVersionsMap: map[string][]*Version{},
-		scarfService:   NewScarfService(scarfEndpoint, scarfTimeout),
+		configFiles:    opts.ConfigFiles,
+		scarfService:   NewScarfService(opts.ScarfEndpoint, opts.ScarfTimeout),
+		strictMode:     opts.StrictMode,
+	}
+	window, err := time.ParseDuration(opts.CardinalityWindow)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to parse cardinality window")
 	}
-	if err := s.validateAndLoadResponseConfig(&config); err != nil {
+	s.cardinalityGuard = newCardinalityGuard(window, opts.CardinalityStateFile)
+	if opts.CardinalityStateFile != "" {
+		if err := s.cardinalityGuard.load(timeNow()); err != nil {
+			return nil, err
+		}
+	}
+	if isRemoteConfigSource(opts.ResponseConfigFilePath) {
+		s.remoteResponseConfig = newRemoteConfigSource(opts.ResponseConfigFilePath)
+	}
+	if err := s.ReloadResponseConfig(); err != nil {
 		return nil, err
 	}
-	if err := s.validateAndLoadRequestSchema(requestSchema); err != nil {
+	if err := s.ReloadRequestSchema(); err != nil {
 		return nil, err
 	}
+	if opts.SigningKeyFile != "" {
+		signingKey, err := loadSigningKey(opts.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.signingKey = signingKey
+	}
+	if len(opts.AdminTokens) > 0 {
+		if err := s.validateAdminConfig(); err != nil {
+			return nil, err
+		}
+		tokens, err := parseAdminTokens(opts.AdminTokens)
+		if err != nil {
+			return nil, err
+		}
+		s.adminTokens = tokens
+		s.changeLogFilePath = opts.ChangeLogFilePath
+		if s.changeLogFilePath == "" {
+			s.changeLogFilePath = opts.ResponseConfigFilePath + defaultChangeLogSuffix
+		}
+		// The history is loaded after the response config, so that a config changed while the server was down is
+		// added to it
+		s.configHistoryFilePath = configHistoryFilePath(s.changeLogFilePath)
+		if err := s.loadConfigHistory(); err != nil {
+			return nil, err
+		}
+	}
 
-	db, err := maxminddb.Open(geodb)
+	db, err := maxminddb.Open(opts.GeoDB)
 	if err != nil {
 		return nil, errors.Wrap(err, "fail to open geodb file")
 	}
 	s.db = db
 	logrus.Debugf("GeoDB opened")
 
-	if influxURL != "" {
+	if opts.InfluxURL != "" {
 		cfg := influxcli.HTTPConfig{
-			Addr:               influxURL,
+			Addr:               opts.InfluxURL,
 			InsecureSkipVerify: true,
 			Timeout:            influxClientTimeOut,
 		}
-		if influxUser != "" {
-			cfg.Username = influxUser
+		if opts.InfluxUser != "" {
+			cfg.Username = opts.InfluxUser
 		}
-		if influxPass != "" {
-			cfg.Password = influxPass
+		if opts.InfluxPass != "" {
+			cfg.Password = opts.InfluxPass
 		}
 		c, err := influxcli.NewHTTPClient(cfg)
 		if err != nil {
@@ -248,16 +360,240 @@ func NewServer(done chan struct{}, applicationName, responseConfigFilePath, requ
 		}
 	}()
 
-	dbCache, err := NewDBCache(InfluxDBDatabase, InfluxDBPrecisionNanosecond, time.Duration(cacheSyncInterval)*time.Second, cacheSize, s.influxClient)
+	dbCache, err := NewDBCache(InfluxDBDatabase, InfluxDBPrecisionNanosecond, time.Duration(opts.CacheSyncInterval)*time.Second, opts.CacheSize, s.influxClient)
 	if err != nil {
 		return nil, err
 	}
 	s.dbCache = dbCache
 	go s.dbCache.Run(done)
 
+	if opts.CardinalityStateFile != "" {
+		s.runCardinalityGuard(done)
+	}
+
+	if opts.ConfigReloadInterval > 0 {
+		go s.watchConfigFiles(done, time.Duration(opts.ConfigReloadInterval)*time.Second)
+	}
+
 	return s, nil
 }
 
+// Wait blocks until the background tasks saving state when done is closed, e.g. the cardinality state, are finished,
+// so that the process doesn't exit in the middle of a write
+func (s *Server) Wait() {
+	s.stopped.Wait()
+}
+
+// loadResponseConfig loads the response config file, or downloads it if the path is an https:// URL
+func loadResponseConfig(files ConfigFiles) (*ResponseConfig, error) {
+	content, err := readConfigSource(files.ResponseConfigFilePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to open responseConfigFile at %v", files.ResponseConfigFilePath)
+	}
+	return parseResponseConfig(content, files)
+}
+
+// parseResponseConfig decodes the content of the response config file in the format of the files, guessed from the
+// file extension if empty, or converts it if it is a GitHub releases document, and adds the advisories of the
+// package in the advisories directory if not empty
+func parseResponseConfig(content []byte, files ConfigFiles) (*ResponseConfig, error) {
+	config := &ResponseConfig{}
+	switch files.ResponseConfigType {
+	case ResponseConfigTypeGitHubReleases:
+		converted, err := ConvertGitHubReleases(content)
+		if err != nil {
+			return nil, err
+		}
+		config = converted
+	case "":
+		lines, err := decodeConfig(content, configFormatOf(files.ResponseConfigFilePath, files.ConfigFormat), config)
+		if err != nil {
+			return nil, err
+		}
+		config.lines = lines
+	default:
+		return nil, ValidateResponseConfigType(files.ResponseConfigType)
+	}
+
+	if files.AdvisoriesDir != "" {
+		advisories, err := loadAdvisoriesDir(files.AdvisoriesDir, files.AdvisoriesPackage)
+		if err != nil {
+			return nil, err
+		}
+		config.Advisories = append(config.Advisories, advisories...)
+	}
+	return config, nil
+}
+
+// loadRequestSchema loads the request schema file in the format, guessed from the file extension if empty.
+// The file can also be a JSON Schema of the request body, which is translated into a request schema.
+func loadRequestSchema(requestSchemaFilePath, format string) (*RequestSchema, error) {
+	content, err := os.ReadFile(filepath.Clean(requestSchemaFilePath))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to open requestSchemaFile at %v", requestSchemaFilePath)
+	}
+
+	format = configFormatOf(requestSchemaFilePath, format)
+	var doc map[string]interface{}
+	lines, err := decodeConfig(content, format, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if isJSONSchema(doc) {
+		return translateJSONSchema(doc, lines)
+	}
+
+	var requestSchema RequestSchema
+	if _, err = decodeConfig(content, format, &requestSchema); err != nil {
+		return nil, err
+	}
+	requestSchema.lines = lines
+	return &requestSchema, nil
+}
+
+// ReloadResponseConfig loads and validates the response config file on a staging server.
+// The version maps in use are only replaced if the new config is valid.
+func (s *Server) ReloadResponseConfig() error {
+	var (
+		content []byte
+		err     error
+	)
+	if s.remoteResponseConfig != nil {
+		content, _, err = s.remoteResponseConfig.fetch()
+	} else {
+		content, err = readConfigSource(s.configFiles.ResponseConfigFilePath)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fail to open responseConfigFile at %v", s.responseConfigSource())
+	}
+	return s.reloadResponseConfig(content)
+}
+
+// reloadResponseConfig loads the content of the response config file if it is valid
+func (s *Server) reloadResponseConfig(content []byte) error {
+	staging, err := s.stageResponseConfig(content)
+	if err != nil {
+		return err
+	}
+	s.swapResponseConfig(staging)
+	return nil
+}
+
+// stageResponseConfig parses and validates the content of the response config file on a staging server
+func (s *Server) stageResponseConfig(content []byte) (*Server, error) {
+	config, err := parseResponseConfig(content, s.configFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	staging := &Server{
+		VersionMap:     map[string]*Version{},
+		TagVersionsMap: map[string][]*Version{},
+	}
+	if err := staging.validateAndLoadResponseConfig(config); err != nil {
+		return nil, errors.Wrapf(err, "invalid response config %v", s.responseConfigSource())
+	}
+	staging.responseConfig = newConfigSnapshot(content, timeNow())
+	return staging, nil
+}
+
+// swapResponseConfig replaces the response config in use by the one loaded on the staging server. The replaced
+// config is added to the history if its content is different.
+func (s *Server) swapResponseConfig(staging *Server) {
+	s.Lock()
+	historyChanged := s.setResponseConfigSnapshot(staging.responseConfig)
+	s.VersionMap = staging.VersionMap
+	s.TagVersionsMap = staging.TagVersionsMap
+	s.channels = staging.channels
+	s.defaultChannel = staging.defaultChannel
+	s.advisories = staging.advisories
+	s.eolWarning = staging.eolWarning
+	s.versions = staging.versions
+	s.responseCache.Store(staging.responseCache.Load())
+	s.Unlock()
+
+	if historyChanged && s.configHistoryFilePath != "" {
+		if err := s.saveConfigHistory(); err != nil {
+			logrus.Errorf("Failed to save config history: %v", err)
+		}
+	}
+}
+
+// ReloadRequestSchema loads and validates the request schema file.
+// The request schema in use is only replaced if the new schema is valid.
+func (s *Server) ReloadRequestSchema() error {
+	requestSchema, err := loadRequestSchema(s.configFiles.RequestSchemaFilePath, s.configFiles.ConfigFormat)
+	if err != nil {
+		return err
+	}
+
+	staging := &Server{}
+	if err := staging.validateAndLoadRequestSchema(*requestSchema); err != nil {
+		return errors.Wrapf(err, "invalid request schema %v", s.configFiles.RequestSchemaFilePath)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.RequestSchema = staging.RequestSchema
+	return nil
+}
+
+// Reload reloads both the response config and the request schema. The one failed to load is kept unchanged.
+func (s *Server) Reload() error {
+	errResponseConfig := s.ReloadResponseConfig()
+	errRequestSchema := s.ReloadRequestSchema()
+	if errResponseConfig != nil {
+		return errResponseConfig
+	}
+	return errRequestSchema
+}
+
+// ValidateConfigFiles validates the response config, with its advisories if any, and the request schema of the files
+// without starting a server. An empty path skips the file. All the problems found are returned.
+func ValidateConfigFiles(files ConfigFiles) []error {
+	var errs []error
+	if files.ResponseConfigFilePath != "" {
+		errs = append(errs, validateFile(files.ResponseConfigFilePath, func() error {
+			config, err := loadResponseConfig(files)
+			if err != nil {
+				return err
+			}
+			staging := &Server{
+				VersionMap:     map[string]*Version{},
+				TagVersionsMap: map[string][]*Version{},
+			}
+			return staging.validateAndLoadResponseConfig(config)
+		})...)
+	}
+	if files.RequestSchemaFilePath != "" {
+		errs = append(errs, validateFile(files.RequestSchemaFilePath, func() error {
+			requestSchema, err := loadRequestSchema(files.RequestSchemaFilePath, files.ConfigFormat)
+			if err != nil {
+				return err
+			}
+			return (&Server{}).validateAndLoadRequestSchema(*requestSchema)
+		})...)
+	}
+	return errs
+}
+
+// validateFile runs validate and splits the returned ValidationError into one error per problem found in the file
+func validateFile(path string, validate func() error) []error {
+	err := validate()
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		return []error{errors.Wrapf(err, "%v", path)}
+	}
+	errs := make([]error, len(validationErr.Errors))
+	for i, e := range validationErr.Errors {
+		errs[i] = errors.Wrapf(e, "%v", path)
+	}
+	return errs
+}
+
 func (s *Server) initDB() error {
 	if err := s.createDB(InfluxDBDatabase); err != nil {
 		return err
@@ -290,6 +626,8 @@ func (s *Server) createContinuousQueries(dbName string) error {
 		InfluxDBContinuousQueryByAppVersion, dbName, utils.ToSnakeCase(ValueFieldKey), InfluxDBMeasurementByAppVersion, InfluxDBMeasurement, InfluxDBContinuousQueryPeriod, InfluxDBTagAppVersion)
 	queryStrings[InfluxDBContinuousQueryByCountryCode] = fmt.Sprintf("CREATE CONTINUOUS QUERY %v ON %v BEGIN SELECT count(%v) as total INTO %v FROM %v GROUP BY time(%v),%v END",
 		InfluxDBContinuousQueryByCountryCode, dbName, utils.ToSnakeCase(ValueFieldKey), InfluxDBMeasurementByCountryCode, InfluxDBMeasurement, InfluxDBContinuousQueryPeriod, InfluxDBTagLocationCountryISOCode)
+	queryStrings[InfluxDBContinuousQueryBySupportStatus] = fmt.Sprintf("CREATE CONTINUOUS QUERY %v ON %v BEGIN SELECT count(%v) as total INTO %v FROM %v GROUP BY time(%v),%v END",
+		InfluxDBContinuousQueryBySupportStatus, dbName, utils.ToSnakeCase(ValueFieldKey), InfluxDBMeasurementBySupportStatus, InfluxDBMeasurement, InfluxDBContinuousQueryPeriod, InfluxDBTagSupportStatus)
 
 	for queryName, queryString := range queryStrings {
 		query := influxcli.NewQuery(queryString, "", "")
@@ -308,73 +646,243 @@ func (s *Server) createContinuousQueries(dbName string) error {
 	return nil
 }
 
+// isNewerVersion returns whether the version is greater than the other one. The invalid versions are reported when
+// they are loaded, so they are not compared.
+func isNewerVersion(version, other string) bool {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return true
+	}
+	o, err := semver.NewVersion(other)
+	if err != nil {
+		return true
+	}
+	return v.GreaterThan(o)
+}
+
 func (s *Server) validateAndLoadResponseConfig(config *ResponseConfig) error {
+	var errs []error
+	for i := range config.Versions {
+		for _, err := range s.validateAndLoadVersion(config, i) {
+			errs = append(errs, config.lines.wrap(err, "versions", i))
+		}
+	}
 	for i, v := range config.Versions {
-		if len(v.Tags) == 0 {
-			return fmt.Errorf("invalid empty label for %v", v)
+		if v.Retracted == nil || v.Retracted.ReplacementVersion == "" {
+			continue
 		}
-		if s.VersionMap[v.Name] != nil {
-			return fmt.Errorf("invalid duplicate name %v", v.Name)
+		replacement := s.VersionMap[v.Retracted.ReplacementVersion]
+		if replacement == nil {
+			errs = append(errs, config.lines.wrap(fmt.Errorf("invalid replacement version %v of retracted version %v: not found", v.Retracted.ReplacementVersion, v.Name), "versions", i))
+		} else if replacement.Retracted != nil {
+			errs = append(errs, config.lines.wrap(fmt.Errorf("invalid replacement version %v of retracted version %v: also retracted", v.Retracted.ReplacementVersion, v.Name), "versions", i))
+		} else if !isNewerVersion(replacement.Name, v.Name) {
+			errs = append(errs, config.lines.wrap(fmt.Errorf("invalid replacement version %v of retracted version %v: not newer", v.Retracted.ReplacementVersion, v.Name), "versions", i))
 		}
-		if _, err := semver.NewVersion(v.Name); err != nil {
-			return err
+	}
+	// The versions not published yet don't count, so that the config is valid until they are published
+	latestCount := 0
+	now := timeNow()
+	for _, v := range s.TagVersionsMap[VersionTagLatest] {
+		if v.isOffered(now) {
+			latestCount++
 		}
-		if v.MinUpgradableVersion != "" {
-			if _, err := semver.NewVersion(v.MinUpgradableVersion); err != nil {
-				return err
-			}
+	}
+	if latestCount == 0 {
+		errs = append(errs, fmt.Errorf("no latest label specified"))
+	}
+	for i, c := range config.Channels {
+		if len(s.TagVersionsMap[c]) == 0 {
+			errs = append(errs, config.lines.wrap(fmt.Errorf("invalid channel %v: no version has this tag", c), "channels", i))
 		}
-		if _, err := ParseTime(v.ReleaseDate); err != nil {
-			return err
+	}
+	if config.DefaultChannel != "" {
+		if len(s.TagVersionsMap[config.DefaultChannel]) == 0 {
+			errs = append(errs, config.lines.wrap(fmt.Errorf("invalid default channel %v: no version has this tag", config.DefaultChannel), "defaultChannel"))
+		} else if len(config.Channels) > 0 && !utils.Contains(config.Channels, config.DefaultChannel) {
+			errs = append(errs, config.lines.wrap(fmt.Errorf("invalid default channel %v: not in the channels %v", config.DefaultChannel, config.Channels), "defaultChannel"))
+		}
+	}
+	advisoryIDs := map[string]bool{}
+	for i := range config.Advisories {
+		a := &config.Advisories[i]
+		if advisoryIDs[a.ID] {
+			errs = append(errs, config.lines.wrap(fmt.Errorf("invalid duplicate advisory ID %v", a.ID), "advisories", i))
+			continue
 		}
-		for _, l := range v.Tags {
-			s.TagVersionsMap[l] = append(s.TagVersionsMap[l], &config.Versions[i])
+		if err := a.validate(); err != nil {
+			errs = append(errs, config.lines.wrap(err, "advisories", i))
+			continue
 		}
-		s.VersionMap[v.Name] = &config.Versions[i]
+		advisoryIDs[a.ID] = true
+		s.advisories = append(s.advisories, a)
+	}
+	if config.EndOfLifeWarningDays < 0 {
+		errs = append(errs, config.lines.wrap(fmt.Errorf("invalid negative endOfLifeWarningDays %v", config.EndOfLifeWarningDays), "endOfLifeWarningDays"))
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	s.eolWarning = defaultEndOfLifeWarningDays * 24 * time.Hour
+	if config.EndOfLifeWarningDays > 0 {
+		s.eolWarning = time.Duration(config.EndOfLifeWarningDays) * 24 * time.Hour
 	}
-	if len(s.TagVersionsMap[VersionTagLatest]) == 0 {
-		return fmt.Errorf("no latest label specified")
+	s.channels = config.Channels
+	s.defaultChannel = config.DefaultChannel
+	if err := s.sortVersions(); err != nil {
+		return err
 	}
+	s.responseCache.Store(s.buildResponseCache(now))
 	return nil
 }
 
-func (s *Server) validateAndLoadRequestSchema(requestSchema RequestSchema) error {
-	if requestSchema.AppVersionSchema.DataType != "string" {
-		return fmt.Errorf("AppVersionSchema must have string data type: %v", requestSchema.AppVersionSchema.DataType)
+// validateAndLoadVersion validates the version at the index of the config and adds it to the version maps
+func (s *Server) validateAndLoadVersion(config *ResponseConfig, i int) []error {
+	var errs []error
+	v := &config.Versions[i]
+	if len(v.Tags) == 0 {
+		errs = append(errs, fmt.Errorf("invalid empty label for %v", *v))
+	}
+	if s.VersionMap[v.Name] != nil {
+		return append(errs, fmt.Errorf("invalid duplicate name %v", v.Name))
+	}
+	if _, err := semver.NewVersion(v.Name); err != nil {
+		return append(errs, errors.Wrapf(err, "invalid name %v", v.Name))
+	}
+	if v.MinUpgradableVersion != "" {
+		if _, err := semver.NewVersion(v.MinUpgradableVersion); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid minUpgradableVersion %v of version %v", v.MinUpgradableVersion, v.Name))
+		}
+	}
+	if _, err := ParseTime(v.ReleaseDate); err != nil {
+		errs = append(errs, errors.Wrapf(err, "invalid release date of version %v", v.Name))
+	}
+	for _, key := range utils.SortedKeys(v.Constraints) {
+		c := v.Constraints[key]
+		if c == nil {
+			errs = append(errs, fmt.Errorf("invalid empty constraint %v of version %v", key, v.Name))
+			continue
+		}
+		if err := c.validate(); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid constraint %v of version %v", key, v.Name))
+		}
+	}
+	if err := validateRollout(v.Rollout); err != nil {
+		errs = append(errs, errors.Wrapf(err, "invalid rollout of version %v", v.Name))
 	}
-	if requestSchema.AppVersionSchema.MaxLen < 0 {
-		return fmt.Errorf("AppVersionSchema must have MaxLen >= 0")
+	if v.Retracted != nil && v.Retracted.Reason == "" {
+		errs = append(errs, fmt.Errorf("invalid empty retraction reason of version %v", v.Name))
 	}
+	if v.PublishAt != "" {
+		if _, err := ParseTime(v.PublishAt); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid publish time of version %v", v.Name))
+		}
+	}
+	if v.EndOfLifeDate != "" {
+		if _, err := ParseTime(v.EndOfLifeDate); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid end of life date of version %v", v.Name))
+		}
+	}
+	switch v.SupportStatus {
+	case "", SupportStatusSupported, SupportStatusNearingEOL, SupportStatusEOL:
+	default:
+		errs = append(errs, fmt.Errorf("invalid support status %v of version %v", v.SupportStatus, v.Name))
+	}
+	for _, l := range v.Tags {
+		s.TagVersionsMap[l] = append(s.TagVersionsMap[l], v)
+	}
+	s.VersionMap[v.Name] = v
+	return errs
+}
 
-	for schemaName, schema := range requestSchema.ExtraFieldInfoSchema {
+// getChannel returns the channel to respond to the request, or an empty string to respond all versions
+func (s *Server) getChannel(request *CheckUpgradeRequest) (string, error) {
+	if request.Channel == "" {
+		return s.defaultChannel, nil
+	}
+	if len(s.channels) > 0 && !utils.Contains(s.channels, request.Channel) {
+		return "", fmt.Errorf("channel %v is not allowed, available channels are %v", request.Channel, s.channels)
+	}
+	if len(s.TagVersionsMap[request.Channel]) == 0 {
+		return "", fmt.Errorf("unknown channel %v", request.Channel)
+	}
+	return request.Channel, nil
+}
+
+func (s *Server) validateAndLoadRequestSchema(requestSchema RequestSchema) error {
+	var errs []error
+	if requestSchema.AppVersionSchema.DataType != DataTypeString {
+		errs = append(errs, requestSchema.lines.wrap(fmt.Errorf("AppVersionSchema must have string data type: %v", requestSchema.AppVersionSchema.DataType), "appVersionSchema"))
+	} else if len(requestSchema.AppVersionSchema.Normalize) > 0 {
+		errs = append(errs, requestSchema.lines.wrap(fmt.Errorf("AppVersionSchema cannot have normalization rules"), "appVersionSchema"))
+	} else if requestSchema.AppVersionSchema.MaxCardinality != 0 {
+		errs = append(errs, requestSchema.lines.wrap(fmt.Errorf("AppVersionSchema cannot have maxCardinality"), "appVersionSchema"))
+	} else {
+		for _, err := range requestSchema.AppVersionSchema.compile() {
+			errs = append(errs, requestSchema.lines.wrap(errors.Wrap(err, "AppVersionSchema"), "appVersionSchema"))
+		}
+	}
+
+	for _, schemaName := range utils.SortedKeys(requestSchema.ExtraFieldInfoSchema) {
+		schema := requestSchema.ExtraFieldInfoSchema[schemaName]
 		switch schema.DataType {
-		case "string":
-			if schema.MaxLen < 0 {
-				return fmt.Errorf("schema %v with data type string must have Maxlen >= 0", schemaName)
+		case DataTypeString, DataTypeFloat, DataTypeInt, DataTypeBoolean:
+			// Fields are not indexed by InfluxDB so their cardinality is not limited
+			if schema.MaxCardinality != 0 || schema.OverflowValue != "" {
+				errs = append(errs, requestSchema.lines.wrap(fmt.Errorf("field schema %v cannot have maxCardinality or overflowValue", schemaName), "extraFieldInfoSchema", schemaName))
+			}
+			for _, err := range schema.compile() {
+				errs = append(errs, requestSchema.lines.wrap(errors.Wrapf(err, "field schema %v", schemaName), "extraFieldInfoSchema", schemaName))
 			}
-		case "float", "boolean":
+			requestSchema.ExtraFieldInfoSchema[schemaName] = schema
 		default:
-			return fmt.Errorf("field schema %v has invalid data type %v", schemaName, schema.DataType)
+			errs = append(errs, requestSchema.lines.wrap(fmt.Errorf("field schema %v has invalid data type %v", schemaName, schema.DataType), "extraFieldInfoSchema", schemaName))
 		}
 	}
 
-	for schemaName, schema := range requestSchema.ExtraTagInfoSchema {
+	for _, schemaName := range utils.SortedKeys(requestSchema.ExtraTagInfoSchema) {
+		schema := requestSchema.ExtraTagInfoSchema[schemaName]
+		// The tags set by the server cannot be overwritten by the clients
+		if tag := utils.ToSnakeCase(schemaName); utils.Contains(reservedTags(), tag) {
+			errs = append(errs, requestSchema.lines.wrap(fmt.Errorf("tag schema %v is reserved since tag %v is set by the server", schemaName, tag), "extraTagInfoSchema", schemaName))
+			continue
+		}
 		switch schema.DataType {
-		case "string":
-			if schema.MaxLen < 0 {
-				return fmt.Errorf("schema %v of data type string must have Maxlen >= 0", schemaName)
+		case DataTypeString:
+			for _, err := range schema.compile() {
+				errs = append(errs, requestSchema.lines.wrap(errors.Wrapf(err, "tag schema %v", schemaName), "extraTagInfoSchema", schemaName))
 			}
+			requestSchema.ExtraTagInfoSchema[schemaName] = schema
 		default:
-			return fmt.Errorf("tag schema %v must have string data type %v", schemaName, schema.DataType)
+			errs = append(errs, requestSchema.lines.wrap(fmt.Errorf("tag schema %v must have string data type %v", schemaName, schema.DataType), "extraTagInfoSchema", schemaName))
 		}
 	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
 
 	s.RequestSchema = requestSchema
 	return nil
 }
 
+// HealthStatus is the response of the health check
+type HealthStatus struct {
+	RemoteResponseConfig *RemoteConfigStatus             `json:"remoteResponseConfig,omitempty"`
+	TagCardinality       map[string]TagCardinalityStatus `json:"tagCardinality,omitempty"`
+}
+
 func (s *Server) HealthCheck(rw http.ResponseWriter, req *http.Request) {
-	rw.WriteHeader(http.StatusOK)
+	status := &HealthStatus{}
+	if s.remoteResponseConfig != nil {
+		status.RemoteResponseConfig = s.remoteResponseConfig.status(timeNow())
+	}
+	if s.cardinalityGuard != nil {
+		status.TagCardinality = s.cardinalityGuard.status(timeNow())
+	}
+	if err := respondWithJSON(rw, status); err != nil {
+		logrus.Errorf("Failed to respondWithJSON: %v", err)
+	}
 }
 
 func (s *Server) CheckUpgrade(rw http.ResponseWriter, req *http.Request) {
@@ -394,6 +902,17 @@ func (s *Server) CheckUpgrade(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	var violations []Violation
+	if s.strictMode != "" {
+		violations = s.validateRequest(&checkReq)
+	}
+	if len(violations) > 0 && s.strictMode == StrictModeReject {
+		if err := respondWithViolations(rw, violations); err != nil {
+			logrus.Errorf("Failed to respondWithViolations: %v", err)
+		}
+		return
+	}
+
 	s.recordRequest(req, &checkReq)
 
 	checkResp, err = s.GenerateCheckUpgradeResponse(&checkReq)
@@ -401,13 +920,57 @@ func (s *Server) CheckUpgrade(rw http.ResponseWriter, req *http.Request) {
 		logrus.Errorf("Failed to GenerateCheckUpgradeResponse: %v", err)
 		return
 	}
+	if len(violations) > 0 {
+		// The response may be shared by the response cache
+		withViolations := *checkResp
+		withViolations.Violations = violations
+		checkResp = &withViolations
+	}
 
-	if err = respondWithJSON(rw, checkResp); err != nil {
+	if err = respondWithJSONAndETag(rw, req, checkResp, s.signingKey, checkReq.AppVersion); err != nil {
 		logrus.Errorf("Failed to repsondWithJSON: %v", err)
 		return
 	}
 }
 
+// respondWithJSONAndETag responds with the ETag of the JSON body, or only with 304 Not Modified if the request
+// has the same ETag in If-None-Match, so that the client can reuse the response it received before.
+// The body is signed with the app version and the nonce of the request if signingKey is not nil, also for 304 Not
+// Modified so that the client can verify the response it reuses is still current.
+func respondWithJSONAndETag(rw http.ResponseWriter, req *http.Request, obj interface{}, signingKey ed25519.PrivateKey, appVersion string) error {
+	response, err := json.Marshal(obj)
+	if err != nil {
+		return errors.Wrapf(err, "fail to marshal %v", obj)
+	}
+	etag := fmt.Sprintf("\"%x\"", sha256.Sum256(response))
+	rw.Header().Set(HTTPHeaderETag, etag)
+	if signingKey != nil {
+		signedAt, signature := signResponse(signingKey, timeNow(), appVersion, req.Header.Get(HTTPHeaderNonce), response)
+		rw.Header().Set(HTTPHeaderSignedAt, signedAt)
+		rw.Header().Set(HTTPHeaderSignature, signature)
+	}
+	if etagMatches(req.Header.Get(HTTPHeaderIfNoneMatch), etag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	_, err = rw.Write(response)
+	return err
+}
+
+// etagMatches returns whether the If-None-Match header value contains the ETag. The weak comparison is used as
+// in RFC 7232.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func respondWithJSON(rw http.ResponseWriter, obj interface{}) error {
 	response, err := json.Marshal(obj)
 	if err != nil {
@@ -420,34 +983,134 @@ func respondWithJSON(rw http.ResponseWriter, obj interface{}) error {
 }
 
 func (s *Server) GenerateCheckUpgradeResponse(request *CheckUpgradeRequest) (*CheckUpgradeResponse, error) {
-	/* disable version dependency reseponse
+	s.RLock()
+	defer s.RUnlock()
+
+	now := timeNow()
+	if resp := s.getCachedResponse(request, now); resp != nil {
+		return resp, nil
+	}
+	return s.generateCheckUpgradeResponse(request, now)
+}
+
+// generateCheckUpgradeResponse builds the response of the request at the time now. The caller must hold the read lock.
+func (s *Server) generateCheckUpgradeResponse(request *CheckUpgradeRequest, now time.Time) (*CheckUpgradeResponse, error) {
 	reqVer, err := semver.NewVersion(request.AppVersion)
+	isValidReqVer := err == nil
 	if err != nil {
-		logrus.Warnf("Invalid version in request: %v: %v, response with the latest version", request.AppVersion, err)
+		logrus.Debugf("Invalid version in request: %v: %v, response with all versions", request.AppVersion, err)
 		reqVer, err = semver.NewVersion(AppMinimalVersion)
 		if err != nil {
 			return nil, err
 		}
 	}
-	*/
-	resp := &CheckUpgradeResponse{}
 
-	// Only supports `latest` label for now
-	//latestVer, version, err := s.getParsedVersionWithTag(VersionTagLatest)
-	//_, version, err := s.getParsedVersionWithTag(VersionTagLatest)
-	//if err != nil {
-	//	logrus.Errorf("BUG: unable to get an valid tag for %v: %v", VersionTagLatest, err)
-	//	return nil, err
-	//}
-	/* disable version dependency reseponse
-	if reqVer.LessThan(latestVer) {
-		resp.Versions = append(resp.Versions, *version)
+	resp := &CheckUpgradeResponse{
+		Versions: []ResponseVersion{},
+	}
+
+	channel, err := s.getChannel(request)
+	if err != nil {
+		return nil, err
+	}
+	clientTags := utils.MergeStringMaps(request.ExtraInfo, request.ExtraTagInfo)
+	clientID := request.rolloutClientID()
+
+	var (
+		newerVersions             []*Version
+		latest, current           *Version
+		latestVer, recommendedVer *semver.Version
+		latestWithheld            bool
+	)
+	// The versions are sorted so that the response is the same for the same request
+	for _, v := range s.versions {
+		ver := v.semver
+		if isValidReqVer && ver.Equal(reqVer) {
+			current = v
+		}
+		if !v.isOffered(now) || !ver.GreaterThan(reqVer) || (channel != "" && !hasTag(v, channel)) || !v.isCompatibleWith(clientTags) {
+			continue
+		}
+		if !v.isRolledOutTo(clientID, now) {
+			latestWithheld = latestWithheld || (channel == "" && hasTag(v, VersionTagLatest))
+			continue
+		}
+		newerVersions = append(newerVersions, v)
+		// The upgrade path leads to the latest version, or to the newest version of the requested channel
+		if (channel != "" || hasTag(v, VersionTagLatest)) && (latestVer == nil || ver.GreaterThan(latestVer)) {
+			latest, latestVer = v, ver
+		}
+
+		upgradable, err := isUpgradableFrom(v, reqVer)
+		if err != nil {
+			return nil, err
+		}
+		resp.Versions = append(resp.Versions, ResponseVersion{
+			Version:    *v,
+			Upgradable: upgradable,
+		})
+		if !upgradable {
+			continue
+		}
+		if hasTag(v, VersionTagLatest) && (recommendedVer == nil || ver.GreaterThan(recommendedVer)) {
+			recommendedVer = ver
+		}
 	}
-	*/
-	//resp.Versions = append(resp.Versions, *version)
 
-	for _, v := range s.VersionMap {
-		resp.Versions = append(resp.Versions, *v)
+	if isValidReqVer {
+		for _, a := range s.advisories {
+			if a.affects(reqVer) {
+				resp.Advisories = append(resp.Advisories, *a)
+			}
+		}
+	}
+
+	if current != nil {
+		resp.SupportStatus = current.getSupportStatus(now, s.eolWarning)
+	}
+
+	// The clients outside the cohort of a latest version being rolled out upgrade to the newest latest or stable
+	// version rolled out to all clients instead, as they would have before the latest tag moved
+	if latest == nil && latestWithheld {
+		for _, v := range newerVersions {
+			if !hasTag(v, VersionTagLatest) && !hasTag(v, VersionTagStable) {
+				continue
+			}
+			if v.rolloutPercentage(now) >= 100 && (latestVer == nil || v.semver.GreaterThan(latestVer)) {
+				latest, latestVer = v, v.semver
+			}
+		}
+	}
+
+	if latest != nil {
+		path, err := findUpgradePath(newerVersions, reqVer, latest)
+		if err != nil {
+			logrus.Debugf("No upgrade path for version %v: %v", request.AppVersion, err)
+		}
+		for _, v := range path {
+			resp.UpgradePath = append(resp.UpgradePath, v.Name)
+		}
+	}
+
+	// Recommend the newest reachable version tagged `latest`, otherwise the first hop of the upgrade path, so that
+	// a client is never recommended a version outside of its path, e.g. an edge or prerelease build
+	if recommendedVer != nil {
+		resp.RecommendedVersion = recommendedVer.Original()
+	} else if len(resp.UpgradePath) > 0 {
+		resp.RecommendedVersion = resp.UpgradePath[0]
+	}
+
+	if current != nil && current.Retracted != nil {
+		resp.Urgent = true
+		resp.Message = fmt.Sprintf("Version %v has been retracted: %v.", current.Name, current.Retracted.Reason)
+		if replacement := current.Retracted.ReplacementVersion; replacement != "" {
+			resp.Message += fmt.Sprintf(" Please move to version %v.", replacement)
+			for _, v := range resp.Versions {
+				if v.Name == replacement && v.Upgradable {
+					resp.RecommendedVersion = replacement
+				}
+			}
+		}
 	}
 
 	d, err := time.ParseDuration(InfluxDBContinuousQueryPeriod)
@@ -461,6 +1124,91 @@ func (s *Server) GenerateCheckUpgradeResponse(request *CheckUpgradeRequest) (*Ch
 	return resp, nil
 }
 
+// getSupportStatus returns the support status at the time now. The version is nearing EOL during the warning
+// period before its end of life date.
+func (v *Version) getSupportStatus(now time.Time, warning time.Duration) string {
+	if v.SupportStatus != "" {
+		return v.SupportStatus
+	}
+	if v.EndOfLifeDate == "" {
+		return SupportStatusSupported
+	}
+	eol, err := ParseTime(v.EndOfLifeDate)
+	if err != nil {
+		logrus.Errorf("BUG: invalid end of life date %v of version %v: %v", v.EndOfLifeDate, v.Name, err)
+		return SupportStatusSupported
+	}
+	if !now.Before(eol) {
+		return SupportStatusEOL
+	}
+	if !now.Before(eol.Add(-warning)) {
+		return SupportStatusNearingEOL
+	}
+	return SupportStatusSupported
+}
+
+// getSupportStatus returns the support status of the app version, or an empty string if it is not in the response config
+func (s *Server) getSupportStatus(appVersion string) string {
+	reqVer, err := semver.NewVersion(appVersion)
+	if err != nil {
+		return ""
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+	for _, v := range s.versions {
+		if v.semver.Equal(reqVer) {
+			return v.getSupportStatus(timeNow(), s.eolWarning)
+		}
+	}
+	return ""
+}
+
+// isOffered returns whether the version can be offered to the clients at the time now
+func (v *Version) isOffered(now time.Time) bool {
+	if v.Retracted != nil {
+		return false
+	}
+	if v.PublishAt == "" {
+		return true
+	}
+	publishAt, err := ParseTime(v.PublishAt)
+	if err != nil {
+		logrus.Errorf("BUG: invalid publish time %v of version %v: %v", v.PublishAt, v.Name, err)
+		return false
+	}
+	return !now.Before(publishAt)
+}
+
+// isUpgradableFrom returns whether the version v can be installed directly on top of the version from
+func isUpgradableFrom(v *Version, from *semver.Version) (bool, error) {
+	if v.MinUpgradableVersion == "" {
+		return true, nil
+	}
+	minVer, err := semver.NewVersion(v.MinUpgradableVersion)
+	if err != nil {
+		return false, errors.Wrapf(err, "BUG: invalid minUpgradableVersion %v of version %v", v.MinUpgradableVersion, v.Name)
+	}
+	return !from.LessThan(minVer), nil
+}
+
+func hasTag(v *Version, tag string) bool {
+	return utils.Contains(v.Tags, tag)
+}
+
+// ValidationError contains all problems found in a response config or a request schema
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
 func ParseTime(t string) (time.Time, error) {
 	return time.Parse(time.RFC3339, t)
 }
@@ -514,8 +1262,11 @@ func (s *Server) recordRequest(httpReq *http.Request, req *CheckUpgradeRequest)
 	}
 
 	// Validate the request before sending events
-	if !s.RequestSchema.AppVersionSchema.Validate(req.AppVersion) {
-		logrus.Errorf("AppVersion %v is not valid according to schema %+v", req.AppVersion, s.RequestSchema.AppVersionSchema)
+	s.RLock()
+	appVersionSchema := s.RequestSchema.AppVersionSchema
+	s.RUnlock()
+	if !appVersionSchema.Validate(req.AppVersion) {
+		logrus.Errorf("AppVersion %v is not valid according to schema %+v", req.AppVersion, appVersionSchema)
 		return
 	}
 
@@ -541,17 +1292,32 @@ func (s *Server) recordRequest(httpReq *http.Request, req *CheckUpgradeRequest)
 	}
 }
 
+// reservedTags returns the tags set by the server from the request, which cannot be in the tag schema
+func reservedTags() []string {
+	return []string{
+		InfluxDBTagAppVersion,
+		InfluxDBTagLocationCity,
+		InfluxDBTagLocationCountry,
+		InfluxDBTagLocationCountryISOCode,
+		InfluxDBTagSupportStatus,
+	}
+}
+
 func (s *Server) getTagsFromRequest(req *CheckUpgradeRequest, location *Location) map[string]string {
 	tags := map[string]string{
 		InfluxDBTagAppVersion: req.AppVersion,
 	}
 	extraTagInfo := utils.MergeStringMaps(req.ExtraInfo, req.ExtraTagInfo)
 	for k, v := range extraTagInfo {
-		if s.ValidateExtraInfo(k, v, extraInfoTypeTag) {
-			tags[utils.ToSnakeCase(k)] = v
+		if normalized, ok := s.normalizeExtraInfo(k, v, extraInfoTypeTag); ok {
+			tags[utils.ToSnakeCase(k)] = s.guardTagCardinality(k, normalized.(string))
 		}
 	}
 
+	if supportStatus := s.getSupportStatus(req.AppVersion); supportStatus != "" {
+		tags[InfluxDBTagSupportStatus] = supportStatus
+	}
+
 	if location != nil {
 		tags[InfluxDBTagLocationCity] = location.City
 		tags[InfluxDBTagLocationCountry] = location.Country.Name
@@ -567,8 +1333,8 @@ func (s *Server) getFieldsFromRequest(req *CheckUpgradeRequest) map[string]inter
 	}
 	fields[utils.ToSnakeCase(ValueFieldKey)] = ValueFieldValue
 	for k, v := range req.ExtraFieldInfo {
-		if s.ValidateExtraInfo(k, v, extraInfoTypeField) {
-			fields[utils.ToSnakeCase(k)] = v
+		if normalized, ok := s.normalizeExtraInfo(k, v, extraInfoTypeField); ok {
+			fields[utils.ToSnakeCase(k)] = normalized
 		}
 	}
 
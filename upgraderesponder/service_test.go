@@ -1,6 +1,16 @@
 package upgraderesponder
 
-import "testing"
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestValidate(t *testing.T) {
 	testCases := []struct {
@@ -61,6 +71,11 @@ func TestValidate(t *testing.T) {
 		{
 			schema:   Schema{DataType: "int"},
 			value:    1.0,
+			expected: true,
+		},
+		{
+			schema:   Schema{DataType: "int"},
+			value:    1.5,
 			expected: false,
 		},
 		{
@@ -73,6 +88,51 @@ func TestValidate(t *testing.T) {
 			value:    1,
 			expected: false,
 		},
+		{
+			schema:   Schema{DataType: "string", Enum: []interface{}{"amd64", "arm64"}},
+			value:    "arm64",
+			expected: true,
+		},
+		{
+			schema:   Schema{DataType: "string", Enum: []interface{}{"amd64", "arm64"}},
+			value:    "s390x",
+			expected: false,
+		},
+		{
+			schema:   Schema{DataType: "float", Enum: []interface{}{1.0, 2.5}},
+			value:    2.5,
+			expected: true,
+		},
+		{
+			schema:   Schema{DataType: "string", Pattern: `^v[0-9]+\.[0-9]+\.[0-9]+$`},
+			value:    "v1.27.4",
+			expected: true,
+		},
+		{
+			schema:   Schema{DataType: "string", Pattern: `^v[0-9]+\.[0-9]+\.[0-9]+$`},
+			value:    "v1.27.4; drop table",
+			expected: false,
+		},
+		{
+			schema:   Schema{DataType: "string", MinLen: 3},
+			value:    "v1",
+			expected: false,
+		},
+		{
+			schema:   Schema{DataType: "int", Min: floatPtr(1), Max: floatPtr(1000)},
+			value:    1000.0,
+			expected: true,
+		},
+		{
+			schema:   Schema{DataType: "int", Min: floatPtr(1), Max: floatPtr(1000)},
+			value:    0.0,
+			expected: false,
+		},
+		{
+			schema:   Schema{DataType: "float", Max: floatPtr(1)},
+			value:    1.5,
+			expected: false,
+		},
 	}
 
 	for i, testCase := range testCases {
@@ -124,6 +184,70 @@ func TestValidateAndLoadRequestSchema(t *testing.T) {
 					"field-3": {DataType: "int"},
 				},
 			},
+			expectedError: false,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema: Schema{DataType: "string", Pattern: "^v[0-9]+"},
+				ExtraTagInfoSchema: map[string]Schema{
+					"tag-1": {DataType: "string", Enum: []interface{}{"amd64", "arm64"}, MinLen: 1},
+				},
+				ExtraFieldInfoSchema: map[string]Schema{
+					"field-1": {DataType: "int", Min: floatPtr(0), Max: floatPtr(100), Enum: []interface{}{0.0, 100.0}},
+				},
+			},
+			expectedError: false,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema: Schema{DataType: "string", Pattern: "^v[0-9"},
+			},
+			expectedError: true,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema: Schema{DataType: "string"},
+				ExtraTagInfoSchema: map[string]Schema{
+					"tag-1": {DataType: "string", MinLen: 10, MaxLen: 5},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema: Schema{DataType: "string"},
+				ExtraTagInfoSchema: map[string]Schema{
+					"tag-1": {DataType: "string", Enum: []interface{}{1.0}},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema: Schema{DataType: "string"},
+				ExtraFieldInfoSchema: map[string]Schema{
+					"field-1": {DataType: "int", Enum: []interface{}{1.5}},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema: Schema{DataType: "string"},
+				ExtraFieldInfoSchema: map[string]Schema{
+					"field-1": {DataType: "float", Min: floatPtr(10), Max: floatPtr(1)},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema: Schema{DataType: "string"},
+				ExtraFieldInfoSchema: map[string]Schema{
+					"field-1": {DataType: "string", Min: floatPtr(1)},
+					"field-2": {DataType: "boolean", Pattern: "true"},
+				},
+			},
 			expectedError: true,
 		},
 		{
@@ -140,6 +264,35 @@ func TestValidateAndLoadRequestSchema(t *testing.T) {
 			},
 			expectedError: false,
 		},
+		// the tags set by the server are reserved
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema:   Schema{DataType: "string"},
+				ExtraTagInfoSchema: map[string]Schema{"supportStatus": {DataType: "string"}},
+			},
+			expectedError: true,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema:   Schema{DataType: "string"},
+				ExtraTagInfoSchema: map[string]Schema{"appVersion": {DataType: "string"}},
+			},
+			expectedError: true,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema:   Schema{DataType: "string"},
+				ExtraTagInfoSchema: map[string]Schema{"country_isocode": {DataType: "string"}},
+			},
+			expectedError: true,
+		},
+		{
+			requestSchema: RequestSchema{
+				AppVersionSchema:   Schema{DataType: "string"},
+				ExtraTagInfoSchema: map[string]Schema{"city": {DataType: "string"}},
+			},
+			expectedError: true,
+		},
 	}
 
 	boolToString := func(b bool) string {
@@ -156,6 +309,10 @@ func TestValidateAndLoadRequestSchema(t *testing.T) {
 	}
 }
 
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
 func TestValidateExtraInfo(t *testing.T) {
 	s := Server{}
 	s.RequestSchema = RequestSchema{
@@ -190,3 +347,782 @@ func TestValidateExtraInfo(t *testing.T) {
 		}
 	}
 }
+
+func newTestServer(t *testing.T, versions []Version) *Server {
+	s := &Server{
+		VersionMap:     map[string]*Version{},
+		TagVersionsMap: map[string][]*Version{},
+	}
+	if err := s.validateAndLoadResponseConfig(&ResponseConfig{Versions: versions}); err != nil {
+		t.Fatalf("failed to load response config: %v", err)
+	}
+	return s
+}
+
+func TestGenerateCheckUpgradeResponse(t *testing.T) {
+	s := newTestServer(t, []Version{
+		{Name: "v1.1.3", ReleaseDate: "2021-12-17T00:00:00Z", Tags: []string{"stable"}},
+		{Name: "v1.2.4", ReleaseDate: "2022-03-17T00:00:00Z", MinUpgradableVersion: "v1.1.0", Tags: []string{"stable"}},
+		{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", MinUpgradableVersion: "v1.2.0", Tags: []string{"latest"}},
+		// an edge build newer than latest, upgradable from any version but never recommended
+		{Name: "v1.4.0-rc1", ReleaseDate: "2022-07-15T00:00:00Z", Tags: []string{"edge"}},
+	})
+
+	testCases := []struct {
+		appVersion          string
+		expectedVersions    []string
+		expectedUpgradable  []string
+		expectedRecommended string
+		expectedUpgradePath []string
+	}{
+		{
+			appVersion:          "v1.0.0",
+			expectedVersions:    []string{"v1.1.3", "v1.2.4", "v1.3.0", "v1.4.0-rc1"},
+			expectedUpgradable:  []string{"v1.1.3", "v1.4.0-rc1"},
+			expectedRecommended: "v1.1.3",
+			expectedUpgradePath: []string{"v1.1.3", "v1.2.4", "v1.3.0"},
+		},
+		{
+			appVersion:          "v1.1.3",
+			expectedVersions:    []string{"v1.2.4", "v1.3.0", "v1.4.0-rc1"},
+			expectedUpgradable:  []string{"v1.2.4", "v1.4.0-rc1"},
+			expectedRecommended: "v1.2.4",
+			expectedUpgradePath: []string{"v1.2.4", "v1.3.0"},
+		},
+		{
+			appVersion:          "v1.2.0",
+			expectedVersions:    []string{"v1.2.4", "v1.3.0", "v1.4.0-rc1"},
+			expectedUpgradable:  []string{"v1.2.4", "v1.3.0", "v1.4.0-rc1"},
+			expectedRecommended: "v1.3.0",
+			expectedUpgradePath: []string{"v1.3.0"},
+		},
+		{
+			// the client on latest is not recommended the edge build
+			appVersion:         "v1.3.0",
+			expectedVersions:   []string{"v1.4.0-rc1"},
+			expectedUpgradable: []string{"v1.4.0-rc1"},
+		},
+		{
+			appVersion:       "v1.4.0-rc1",
+			expectedVersions: []string{},
+		},
+		{
+			appVersion:          "invalid",
+			expectedVersions:    []string{"v1.1.3", "v1.2.4", "v1.3.0", "v1.4.0-rc1"},
+			expectedUpgradable:  []string{"v1.1.3", "v1.4.0-rc1"},
+			expectedRecommended: "v1.1.3",
+			expectedUpgradePath: []string{"v1.1.3", "v1.2.4", "v1.3.0"},
+		},
+	}
+
+	for i, testCase := range testCases {
+		resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: testCase.appVersion})
+		if err != nil {
+			t.Fatalf("Test case %v: unexpected error %v", i, err)
+		}
+		versions, upgradable := []string{}, []string{}
+		for _, v := range resp.Versions {
+			versions = append(versions, v.Name)
+			if v.Upgradable {
+				upgradable = append(upgradable, v.Name)
+			}
+		}
+		sort.Strings(versions)
+		sort.Strings(upgradable)
+		if !equalStrings(versions, testCase.expectedVersions) {
+			t.Errorf("Test case %v: versions %v not equal to expected %v", i, versions, testCase.expectedVersions)
+		}
+		if !equalStrings(upgradable, testCase.expectedUpgradable) {
+			t.Errorf("Test case %v: upgradable versions %v not equal to expected %v", i, upgradable, testCase.expectedUpgradable)
+		}
+		if resp.RecommendedVersion != testCase.expectedRecommended {
+			t.Errorf("Test case %v: recommended version %v not equal to expected %v", i, resp.RecommendedVersion, testCase.expectedRecommended)
+		}
+		if !equalStrings(resp.UpgradePath, testCase.expectedUpgradePath) {
+			t.Errorf("Test case %v: upgrade path %v not equal to expected %v", i, resp.UpgradePath, testCase.expectedUpgradePath)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReloadResponseConfig(t *testing.T) {
+	dir := t.TempDir()
+	s := &Server{
+		configFiles: ConfigFiles{
+			ResponseConfigFilePath: filepath.Join(dir, "response.json"),
+			RequestSchemaFilePath:  filepath.Join(dir, "schema.json"),
+		},
+	}
+
+	writeFile := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile(s.configFiles.ResponseConfigFilePath, `{"versions": [{"name": "v1.0.0", "releaseDate": "2020-05-30T10:20:00Z", "tags": ["latest"]}]}`)
+	writeFile(s.configFiles.RequestSchemaFilePath, `{"appVersionSchema": {"dataType": "string", "maxLen": 10}}`)
+	if err := s.Reload(); err != nil {
+		t.Fatalf("failed to load valid config: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v0.9.0"}); err != nil {
+				t.Errorf("unexpected error while reloading: %v", err)
+				return
+			}
+			s.ValidateExtraInfo("tag-1", "value", extraInfoTypeTag)
+		}
+	}()
+
+	writeFile(s.configFiles.ResponseConfigFilePath, `{"versions": [{"name": "v1.1.0", "releaseDate": "2020-06-30T10:20:00Z", "tags": ["latest"]}]}`)
+	if err := s.ReloadResponseConfig(); err != nil {
+		t.Errorf("failed to reload valid config: %v", err)
+	}
+	if s.VersionMap["v1.1.0"] == nil || s.VersionMap["v1.0.0"] != nil {
+		t.Errorf("response config is not replaced: %+v", s.VersionMap)
+	}
+
+	// The invalid config has no latest version, the previous one must be kept
+	writeFile(s.configFiles.ResponseConfigFilePath, `{"versions": [{"name": "v1.2.0", "releaseDate": "2020-07-30T10:20:00Z", "tags": ["stable"]}]}`)
+	if err := s.ReloadResponseConfig(); err == nil {
+		t.Errorf("expected error for invalid config")
+	}
+	if s.VersionMap["v1.1.0"] == nil || s.VersionMap["v1.2.0"] != nil {
+		t.Errorf("invalid response config is loaded: %+v", s.VersionMap)
+	}
+
+	writeFile(s.configFiles.RequestSchemaFilePath, `{"appVersionSchema": {"dataType": "float"}}`)
+	if err := s.ReloadRequestSchema(); err == nil {
+		t.Errorf("expected error for invalid request schema")
+	}
+	if s.RequestSchema.AppVersionSchema.DataType != "string" {
+		t.Errorf("invalid request schema is loaded: %+v", s.RequestSchema)
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestGenerateCheckUpgradeResponseWithChannel(t *testing.T) {
+	s := &Server{
+		VersionMap:     map[string]*Version{},
+		TagVersionsMap: map[string][]*Version{},
+	}
+	config := &ResponseConfig{
+		Versions: []Version{
+			{Name: "v1.2.4", ReleaseDate: "2022-03-17T00:00:00Z", Tags: []string{"stable"}},
+			{Name: "v1.2.5", ReleaseDate: "2022-04-17T00:00:00Z", Tags: []string{"stable"}},
+			{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest", "edge"}},
+			{Name: "v1.4.0-rc1", ReleaseDate: "2022-07-15T00:00:00Z", Tags: []string{"edge"}},
+		},
+		Channels:       []string{"stable", "edge"},
+		DefaultChannel: "stable",
+	}
+	if err := s.validateAndLoadResponseConfig(config); err != nil {
+		t.Fatalf("failed to load response config: %v", err)
+	}
+
+	testCases := []struct {
+		channel          string
+		expectedVersions []string
+		expectedPath     []string
+		expectedError    bool
+	}{
+		{
+			channel:          "",
+			expectedVersions: []string{"v1.2.4", "v1.2.5"},
+			expectedPath:     []string{"v1.2.5"},
+		},
+		{
+			channel:          "stable",
+			expectedVersions: []string{"v1.2.4", "v1.2.5"},
+			expectedPath:     []string{"v1.2.5"},
+		},
+		{
+			channel:          "edge",
+			expectedVersions: []string{"v1.3.0", "v1.4.0-rc1"},
+			expectedPath:     []string{"v1.4.0-rc1"},
+		},
+		{
+			// a tag not in the allowed channels
+			channel:       "latest",
+			expectedError: true,
+		},
+		{
+			channel:       "unknown",
+			expectedError: true,
+		},
+	}
+
+	for i, testCase := range testCases {
+		resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.0", Channel: testCase.channel})
+		if testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: expected error %v but got %v", i, testCase.expectedError, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		versions := []string{}
+		for _, v := range resp.Versions {
+			versions = append(versions, v.Name)
+		}
+		sort.Strings(versions)
+		if !equalStrings(versions, testCase.expectedVersions) {
+			t.Errorf("Test case %v: versions %v not equal to expected %v", i, versions, testCase.expectedVersions)
+		}
+		if !equalStrings(resp.UpgradePath, testCase.expectedPath) {
+			t.Errorf("Test case %v: upgrade path %v not equal to expected %v", i, resp.UpgradePath, testCase.expectedPath)
+		}
+	}
+}
+
+func TestValidateAndLoadResponseConfigChannels(t *testing.T) {
+	versions := []Version{
+		{Name: "v1.2.4", ReleaseDate: "2022-03-17T00:00:00Z", Tags: []string{"stable"}},
+		{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest"}},
+	}
+
+	testCases := []struct {
+		channels       []string
+		defaultChannel string
+		expectedError  bool
+	}{
+		{channels: nil, defaultChannel: "", expectedError: false},
+		{channels: nil, defaultChannel: "stable", expectedError: false},
+		{channels: []string{"stable", "latest"}, defaultChannel: "stable", expectedError: false},
+		{channels: []string{"stable", "edge"}, defaultChannel: "stable", expectedError: true},
+		{channels: []string{"latest"}, defaultChannel: "stable", expectedError: true},
+		{channels: nil, defaultChannel: "edge", expectedError: true},
+	}
+
+	for i, testCase := range testCases {
+		s := &Server{
+			VersionMap:     map[string]*Version{},
+			TagVersionsMap: map[string][]*Version{},
+		}
+		err := s.validateAndLoadResponseConfig(&ResponseConfig{
+			Versions:       versions,
+			Channels:       testCase.channels,
+			DefaultChannel: testCase.defaultChannel,
+		})
+		if testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: expected error %v but got %v", i, testCase.expectedError, err)
+		}
+	}
+}
+
+func TestGenerateCheckUpgradeResponseWithRetraction(t *testing.T) {
+	s := newTestServer(t, []Version{
+		{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"stable"}},
+		{Name: "v1.3.1", ReleaseDate: "2022-07-15T00:00:00Z", Tags: []string{"stable"},
+			Retracted: &Retraction{Reason: "data corruption on volume expansion", ReplacementVersion: "v1.3.2"}},
+		{Name: "v1.3.2", ReleaseDate: "2022-07-20T00:00:00Z", Tags: []string{"stable"}},
+		{Name: "v1.4.0", ReleaseDate: "2022-08-15T00:00:00Z", Tags: []string{"latest"}},
+	})
+
+	resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.3.0"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, v := range resp.Versions {
+		if v.Name == "v1.3.1" {
+			t.Errorf("retracted version is offered")
+		}
+	}
+	if resp.Urgent || resp.Message != "" {
+		t.Errorf("unexpected urgent response for non-retracted version: %+v", resp)
+	}
+	if resp.RecommendedVersion != "v1.4.0" {
+		t.Errorf("recommended version %v not equal to expected v1.4.0", resp.RecommendedVersion)
+	}
+
+	resp, err = s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.3.1"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !resp.Urgent {
+		t.Errorf("expected urgent response for retracted version")
+	}
+	if expected := "Version v1.3.1 has been retracted: data corruption on volume expansion. Please move to version v1.3.2."; resp.Message != expected {
+		t.Errorf("message %q not equal to expected %q", resp.Message, expected)
+	}
+	if resp.RecommendedVersion != "v1.3.2" {
+		t.Errorf("recommended version %v not equal to the replacement version v1.3.2", resp.RecommendedVersion)
+	}
+}
+
+func TestValidateAndLoadResponseConfigRetraction(t *testing.T) {
+	testCases := []struct {
+		versions      []Version
+		expectedError bool
+	}{
+		{
+			versions: []Version{
+				{Name: "v1.3.1", ReleaseDate: "2022-07-15T00:00:00Z", Tags: []string{"stable"}, Retracted: &Retraction{Reason: "bug", ReplacementVersion: "v1.3.2"}},
+				{Name: "v1.3.2", ReleaseDate: "2022-07-20T00:00:00Z", Tags: []string{"latest"}},
+			},
+			expectedError: false,
+		},
+		{
+			// missing reason
+			versions: []Version{
+				{Name: "v1.3.1", ReleaseDate: "2022-07-15T00:00:00Z", Tags: []string{"stable"}, Retracted: &Retraction{}},
+				{Name: "v1.3.2", ReleaseDate: "2022-07-20T00:00:00Z", Tags: []string{"latest"}},
+			},
+			expectedError: true,
+		},
+		{
+			// unknown replacement
+			versions: []Version{
+				{Name: "v1.3.1", ReleaseDate: "2022-07-15T00:00:00Z", Tags: []string{"stable"}, Retracted: &Retraction{Reason: "bug", ReplacementVersion: "v1.3.3"}},
+				{Name: "v1.3.2", ReleaseDate: "2022-07-20T00:00:00Z", Tags: []string{"latest"}},
+			},
+			expectedError: true,
+		},
+		{
+			// retracted replacement
+			versions: []Version{
+				{Name: "v1.3.1", ReleaseDate: "2022-07-15T00:00:00Z", Tags: []string{"stable"}, Retracted: &Retraction{Reason: "bug", ReplacementVersion: "v1.3.2"}},
+				{Name: "v1.3.2", ReleaseDate: "2022-07-20T00:00:00Z", Tags: []string{"stable"}, Retracted: &Retraction{Reason: "bug"}},
+				{Name: "v1.4.0", ReleaseDate: "2022-08-20T00:00:00Z", Tags: []string{"latest"}},
+			},
+			expectedError: true,
+		},
+		{
+			// older replacement
+			versions: []Version{
+				{Name: "v1.3.1", ReleaseDate: "2022-07-15T00:00:00Z", Tags: []string{"stable"}, Retracted: &Retraction{Reason: "bug", ReplacementVersion: "v1.3.0"}},
+				{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest"}},
+			},
+			expectedError: true,
+		},
+		{
+			// the retracted version itself
+			versions: []Version{
+				{Name: "v1.3.1", ReleaseDate: "2022-07-15T00:00:00Z", Tags: []string{"stable"}, Retracted: &Retraction{Reason: "bug", ReplacementVersion: "v1.3.1"}},
+				{Name: "v1.3.2", ReleaseDate: "2022-07-20T00:00:00Z", Tags: []string{"latest"}},
+			},
+			expectedError: true,
+		},
+		{
+			// the only latest version is retracted
+			versions: []Version{
+				{Name: "v1.3.1", ReleaseDate: "2022-07-15T00:00:00Z", Tags: []string{"latest"}, Retracted: &Retraction{Reason: "bug"}},
+			},
+			expectedError: true,
+		},
+	}
+
+	for i, testCase := range testCases {
+		s := &Server{
+			VersionMap:     map[string]*Version{},
+			TagVersionsMap: map[string][]*Version{},
+		}
+		err := s.validateAndLoadResponseConfig(&ResponseConfig{Versions: testCase.versions})
+		if testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: expected error %v but got %v", i, testCase.expectedError, err)
+		}
+	}
+}
+
+func TestGetSupportStatus(t *testing.T) {
+	warning := 30 * 24 * time.Hour
+	testCases := []struct {
+		version  Version
+		now      string
+		expected string
+	}{
+		{version: Version{Name: "v1.3.0"}, now: "2023-01-01T00:00:00Z", expected: SupportStatusSupported},
+		{version: Version{Name: "v1.3.0", EndOfLifeDate: "2023-06-01T00:00:00Z"}, now: "2023-01-01T00:00:00Z", expected: SupportStatusSupported},
+		{version: Version{Name: "v1.3.0", EndOfLifeDate: "2023-06-01T00:00:00Z"}, now: "2023-05-15T00:00:00Z", expected: SupportStatusNearingEOL},
+		{version: Version{Name: "v1.3.0", EndOfLifeDate: "2023-06-01T00:00:00Z"}, now: "2023-06-01T00:00:00Z", expected: SupportStatusEOL},
+		{version: Version{Name: "v1.3.0", EndOfLifeDate: "2023-06-01T00:00:00Z", SupportStatus: SupportStatusEOL}, now: "2023-01-01T00:00:00Z", expected: SupportStatusEOL},
+	}
+
+	for i, testCase := range testCases {
+		now, _ := ParseTime(testCase.now)
+		if output := testCase.version.getSupportStatus(now, warning); output != testCase.expected {
+			t.Errorf("Test case %v: %+v Output %v not equal to expected %v", i, testCase, output, testCase.expected)
+		}
+	}
+}
+
+func TestSupportStatusOfRequester(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time {
+		now, _ := ParseTime("2023-05-15T00:00:00Z")
+		return now
+	}
+
+	s := &Server{
+		VersionMap:     map[string]*Version{},
+		TagVersionsMap: map[string][]*Version{},
+	}
+	if err := s.validateAndLoadResponseConfig(&ResponseConfig{
+		Versions: []Version{
+			{Name: "v1.2.4", ReleaseDate: "2022-03-17T00:00:00Z", Tags: []string{"stable"}, EndOfLifeDate: "2023-03-17T00:00:00Z"},
+			{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"stable"}, EndOfLifeDate: "2023-06-01T00:00:00Z"},
+			{Name: "v1.4.0", ReleaseDate: "2023-01-15T00:00:00Z", Tags: []string{"latest"}, EndOfLifeDate: "2024-01-15T00:00:00Z"},
+		},
+		EndOfLifeWarningDays: 30,
+	}); err != nil {
+		t.Fatalf("failed to load response config: %v", err)
+	}
+
+	testCases := []struct {
+		appVersion string
+		expected   string
+	}{
+		{appVersion: "v1.2.4", expected: SupportStatusEOL},
+		{appVersion: "1.3.0", expected: SupportStatusNearingEOL},
+		{appVersion: "v1.4.0", expected: SupportStatusSupported},
+		{appVersion: "v1.1.0", expected: ""},
+		{appVersion: "invalid", expected: ""},
+	}
+	for i, testCase := range testCases {
+		resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: testCase.appVersion})
+		if err != nil {
+			t.Fatalf("Test case %v: unexpected error %v", i, err)
+		}
+		if resp.SupportStatus != testCase.expected {
+			t.Errorf("Test case %v: support status %v not equal to expected %v", i, resp.SupportStatus, testCase.expected)
+		}
+		tags := s.getTagsFromRequest(&CheckUpgradeRequest{AppVersion: testCase.appVersion}, nil)
+		if tags[InfluxDBTagSupportStatus] != testCase.expected {
+			t.Errorf("Test case %v: support status tag %v not equal to expected %v", i, tags[InfluxDBTagSupportStatus], testCase.expected)
+		}
+	}
+}
+
+func TestValidateAndLoadResponseConfigSupportStatus(t *testing.T) {
+	testCases := []struct {
+		version       Version
+		warningDays   int
+		expectedError bool
+	}{
+		{version: Version{EndOfLifeDate: "2023-06-01T00:00:00Z", SupportStatus: SupportStatusNearingEOL}, expectedError: false},
+		{version: Version{EndOfLifeDate: "2023-06-01"}, expectedError: true},
+		{version: Version{SupportStatus: "deprecated"}, expectedError: true},
+		{version: Version{}, warningDays: -1, expectedError: true},
+	}
+
+	for i, testCase := range testCases {
+		s := &Server{
+			VersionMap:     map[string]*Version{},
+			TagVersionsMap: map[string][]*Version{},
+		}
+		v := testCase.version
+		v.Name, v.ReleaseDate, v.Tags = "v1.3.0", "2022-06-15T00:00:00Z", []string{"latest"}
+		err := s.validateAndLoadResponseConfig(&ResponseConfig{Versions: []Version{v}, EndOfLifeWarningDays: testCase.warningDays})
+		if testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: expected error %v but got %v", i, testCase.expectedError, err)
+		}
+	}
+}
+
+func TestPublishAt(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	setNow := func(now string) {
+		timeNow = func() time.Time {
+			ts, _ := ParseTime(now)
+			return ts
+		}
+	}
+
+	versions := []Version{
+		{Name: "v1.2.4", ReleaseDate: "2022-03-17T00:00:00Z", Tags: []string{"latest"}},
+		{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest"}, PublishAt: "2022-06-15T16:00:00Z"},
+	}
+
+	setNow("2022-06-15T10:00:00Z")
+	s := newTestServer(t, versions)
+	resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.0"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(resp.Versions) != 1 || resp.Versions[0].Name != "v1.2.4" || resp.RecommendedVersion != "v1.2.4" {
+		t.Errorf("unexpected response before the publish time: %+v", resp)
+	}
+
+	setNow("2022-06-15T16:00:00Z")
+	resp, err = s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.0"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(resp.Versions) != 2 || resp.RecommendedVersion != "v1.3.0" {
+		t.Errorf("unexpected response after the publish time: %+v", resp)
+	}
+
+	// The version not published yet doesn't count as the latest version
+	setNow("2022-06-15T10:00:00Z")
+	s = &Server{
+		VersionMap:     map[string]*Version{},
+		TagVersionsMap: map[string][]*Version{},
+	}
+	versions[0].Tags = []string{"stable"}
+	if err := s.validateAndLoadResponseConfig(&ResponseConfig{Versions: versions}); err == nil {
+		t.Errorf("expected error for config without published latest version")
+	}
+
+	s = &Server{
+		VersionMap:     map[string]*Version{},
+		TagVersionsMap: map[string][]*Version{},
+	}
+	versions[1].PublishAt = "invalid"
+	if err := s.validateAndLoadResponseConfig(&ResponseConfig{Versions: versions}); err == nil {
+		t.Errorf("expected error for invalid publish time")
+	}
+}
+
+func TestValidateConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	validResponseConfig := writeFile("valid-response.json", `{"versions": [{"name": "v1.0.0", "releaseDate": "2020-05-30T10:20:00Z", "tags": ["latest"]}]}`)
+	validRequestSchema := writeFile("valid-schema.json", `{"appVersionSchema": {"dataType": "string", "maxLen": 10}}`)
+	invalidResponseConfig := writeFile("invalid-response.json", `{"versions": [
+		{"name": "invalid", "releaseDate": "2020-05-30T10:20:00Z", "tags": ["stable"]},
+		{"name": "v1.0.0", "releaseDate": "invalid", "tags": ["stable"]}
+	]}`)
+	invalidRequestSchema := writeFile("invalid-schema.json", `{
+		"appVersionSchema": {"dataType": "float"},
+		"extraTagInfoSchema": {"tag-1": {"dataType": "float"}}
+	}`)
+
+	testCases := []struct {
+		responseConfig string
+		requestSchema  string
+		expectedErrors int
+	}{
+		{responseConfig: validResponseConfig, requestSchema: validRequestSchema, expectedErrors: 0},
+		{responseConfig: validResponseConfig, requestSchema: "", expectedErrors: 0},
+		// invalid name, invalid release date, no latest label
+		{responseConfig: invalidResponseConfig, requestSchema: validRequestSchema, expectedErrors: 3},
+		{responseConfig: validResponseConfig, requestSchema: invalidRequestSchema, expectedErrors: 2},
+		{responseConfig: invalidResponseConfig, requestSchema: invalidRequestSchema, expectedErrors: 5},
+		{responseConfig: filepath.Join(dir, "not-found.json"), requestSchema: "", expectedErrors: 1},
+	}
+
+	for i, testCase := range testCases {
+		errs := ValidateConfigFiles(ConfigFiles{ResponseConfigFilePath: testCase.responseConfig, RequestSchemaFilePath: testCase.requestSchema})
+		if len(errs) != testCase.expectedErrors {
+			t.Errorf("Test case %v: expected %v errors but got %v: %v", i, testCase.expectedErrors, len(errs), errs)
+		}
+	}
+}
+
+func TestValidateConfigFilesReplacementVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "response.json")
+	content := `{"versions": [
+	{"name": "v1.3.0", "releaseDate": "2022-06-15T00:00:00Z", "tags": ["latest"]},
+	{"name": "v1.3.1", "releaseDate": "2022-07-15T00:00:00Z", "tags": ["stable"], "retracted": {"reason": "bug", "replacementVersion": "v1.3.0"}}
+]}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := ValidateConfigFiles(ConfigFiles{ResponseConfigFilePath: path})
+	expected := path + ": line 3: invalid replacement version v1.3.0 of retracted version v1.3.1: not newer"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("errors are %v, expected %v", errs, expected)
+	}
+}
+
+func TestGenerateCheckUpgradeResponseSorted(t *testing.T) {
+	versions := []Version{
+		{Name: "v1.2.10", ReleaseDate: "2022-09-01T00:00:00Z", Tags: []string{"stable"}},
+		{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest"}},
+		{Name: "v1.2.9", ReleaseDate: "2022-08-01T00:00:00Z", Tags: []string{"stable"}},
+		{Name: "v1.3.1", ReleaseDate: "2022-07-15T00:00:00Z", Tags: []string{"latest"}},
+		{Name: "v1.2.4", ReleaseDate: "2022-03-17T00:00:00Z", Tags: []string{"stable"}},
+	}
+	s := newTestServer(t, versions)
+	if s.responseCache.Load() == nil {
+		t.Fatalf("expected the responses to be precomputed")
+	}
+
+	testCases := []struct {
+		appVersion string
+		expected   []string
+	}{
+		{appVersion: "v1.2.4", expected: []string{"v1.3.1", "v1.3.0", "v1.2.10", "v1.2.9"}},
+		{appVersion: "1.2.4", expected: []string{"v1.3.1", "v1.3.0", "v1.2.10", "v1.2.9"}},
+		{appVersion: "invalid", expected: []string{"v1.3.1", "v1.3.0", "v1.2.10", "v1.2.9", "v1.2.4"}},
+	}
+	for i, testCase := range testCases {
+		// The order must not change between the requests
+		for j := 0; j < 10; j++ {
+			resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: testCase.appVersion})
+			if err != nil {
+				t.Fatalf("Test case %v: unexpected error %v", i, err)
+			}
+			names := []string{}
+			for _, v := range resp.Versions {
+				names = append(names, v.Name)
+			}
+			if !equalStrings(names, testCase.expected) {
+				t.Fatalf("Test case %v: versions %v not equal to expected %v", i, names, testCase.expected)
+			}
+		}
+	}
+
+	// The precomputed response is the same as the generated one
+	s.RLock()
+	generated, err := s.generateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.9"}, timeNow())
+	s.RUnlock()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	cached, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.9"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	generatedJSON, _ := json.Marshal(generated)
+	cachedJSON, _ := json.Marshal(cached)
+	if string(generatedJSON) != string(cachedJSON) {
+		t.Errorf("precomputed response %s not equal to generated response %s", cachedJSON, generatedJSON)
+	}
+}
+
+func TestBuildResponseCache(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	setNow := func(now string) {
+		timeNow = func() time.Time {
+			ts, _ := ParseTime(now)
+			return ts
+		}
+	}
+	setNow("2022-06-15T10:00:00Z")
+
+	s := newTestServer(t, []Version{
+		{Name: "v1.2.4", ReleaseDate: "2022-03-17T00:00:00Z", Tags: []string{"stable"}, EndOfLifeDate: "2022-12-31T00:00:00Z"},
+		{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest"}, PublishAt: "2022-06-15T12:00:00Z"},
+		{Name: "v1.2.0", ReleaseDate: "2022-01-01T00:00:00Z", Tags: []string{"latest"}},
+	})
+	cache := s.responseCache.Load()
+	if cache == nil {
+		t.Fatalf("expected the responses to be precomputed")
+	}
+	if expected := "2022-06-15T12:00:00Z"; cache.validUntil.Format(time.RFC3339) != expected {
+		t.Errorf("cache valid until %v not equal to expected %v", cache.validUntil, expected)
+	}
+
+	testCases := []struct {
+		now                   string
+		expectedVersions      int
+		expectedSupportStatus string
+	}{
+		{now: "2022-06-15T11:00:00Z", expectedVersions: 1, expectedSupportStatus: SupportStatusSupported},
+		{now: "2022-06-15T12:00:00Z", expectedVersions: 2, expectedSupportStatus: SupportStatusSupported},
+		{now: "2022-10-15T00:00:00Z", expectedVersions: 2, expectedSupportStatus: SupportStatusNearingEOL},
+		{now: "2023-01-01T00:00:00Z", expectedVersions: 2, expectedSupportStatus: SupportStatusEOL},
+		{now: "2022-06-15T11:00:00Z", expectedVersions: 1, expectedSupportStatus: SupportStatusSupported},
+	}
+	for i, testCase := range testCases {
+		setNow(testCase.now)
+		resp, err := s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.0"})
+		if err != nil {
+			t.Fatalf("Test case %v: unexpected error %v", i, err)
+		}
+		if len(resp.Versions) != testCase.expectedVersions {
+			t.Errorf("Test case %v: %v versions not equal to expected %v", i, len(resp.Versions), testCase.expectedVersions)
+		}
+		resp, err = s.GenerateCheckUpgradeResponse(&CheckUpgradeRequest{AppVersion: "v1.2.4"})
+		if err != nil {
+			t.Fatalf("Test case %v: unexpected error %v", i, err)
+		}
+		if resp.SupportStatus != testCase.expectedSupportStatus {
+			t.Errorf("Test case %v: support status %v not equal to expected %v", i, resp.SupportStatus, testCase.expectedSupportStatus)
+		}
+	}
+
+	// The responses depending on the client are not precomputed
+	s = newTestServer(t, []Version{
+		{Name: "v1.3.0", ReleaseDate: "2022-06-15T00:00:00Z", Tags: []string{"latest"}, Constraints: map[string]*Constraint{"kubernetesVersion": {Range: ">=1.21.0"}}},
+	})
+	if s.responseCache.Load() != nil {
+		t.Errorf("unexpected precomputed responses for the versions with constraints")
+	}
+}
+
+func TestRespondWithJSONAndETag(t *testing.T) {
+	resp := &CheckUpgradeResponse{Versions: []ResponseVersion{{Version: Version{Name: "v1.0.0"}}}, RequestIntervalInMinutes: 60}
+
+	respond := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/checkupgrade", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set(HTTPHeaderIfNoneMatch, ifNoneMatch)
+		}
+		rw := httptest.NewRecorder()
+		if err := respondWithJSONAndETag(rw, req, resp, nil, ""); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return rw
+	}
+
+	rw := respond("")
+	etag := rw.Header().Get(HTTPHeaderETag)
+	if rw.Code != http.StatusOK || etag == "" || rw.Body.Len() == 0 {
+		t.Fatalf("unexpected response %v with ETag %v and body %v", rw.Code, etag, rw.Body.String())
+	}
+	if other := respond("").Header().Get(HTTPHeaderETag); other != etag {
+		t.Errorf("ETag %v of the same response not equal to %v", other, etag)
+	}
+
+	testCases := []struct {
+		ifNoneMatch  string
+		expectedCode int
+	}{
+		{ifNoneMatch: etag, expectedCode: http.StatusNotModified},
+		{ifNoneMatch: "W/" + etag, expectedCode: http.StatusNotModified},
+		{ifNoneMatch: `"other", ` + etag, expectedCode: http.StatusNotModified},
+		{ifNoneMatch: "*", expectedCode: http.StatusNotModified},
+		{ifNoneMatch: `"other"`, expectedCode: http.StatusOK},
+	}
+	for i, testCase := range testCases {
+		rw := respond(testCase.ifNoneMatch)
+		if rw.Code != testCase.expectedCode {
+			t.Errorf("Test case %v: status code %v not equal to expected %v", i, rw.Code, testCase.expectedCode)
+		}
+		if rw.Code == http.StatusNotModified && rw.Body.Len() != 0 {
+			t.Errorf("Test case %v: unexpected body %v with 304", i, rw.Body.String())
+		}
+		if rw.Header().Get(HTTPHeaderETag) != etag {
+			t.Errorf("Test case %v: ETag %v not equal to expected %v", i, rw.Header().Get(HTTPHeaderETag), etag)
+		}
+	}
+
+	resp.RecommendedVersion = "v1.0.0"
+	if rw := respond(etag); rw.Code != http.StatusOK || rw.Header().Get(HTTPHeaderETag) == etag {
+		t.Errorf("expected the changed response with a new ETag, got %v with ETag %v", rw.Code, rw.Header().Get(HTTPHeaderETag))
+	}
+}
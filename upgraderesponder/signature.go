@@ -0,0 +1,75 @@
+package upgraderesponder
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// HTTPHeaderSignature contains the base64 encoded Ed25519 signature of the signed envelope of the response
+	HTTPHeaderSignature = "X-Upgrade-Responder-Signature"
+	// HTTPHeaderSignedAt contains the time the response was signed at in RFC 3339, part of the signed envelope
+	HTTPHeaderSignedAt = "X-Upgrade-Responder-Signed-At"
+	// HTTPHeaderNonce contains the random value of the client request, part of the signed envelope
+	HTTPHeaderNonce = "X-Upgrade-Responder-Nonce"
+)
+
+// signatureEnvelope is what the signature covers: the response body bound to the time it was signed at and to the
+// request, so that a response can neither be replayed later nor to another client. The client rebuilds it from the
+// body, the Signed-At header and its own request to verify the signature.
+type signatureEnvelope struct {
+	SignedAt   string `json:"signedAt"`
+	AppVersion string `json:"appVersion"` // the app version of the request
+	Nonce      string `json:"nonce"`      // the nonce header of the request, empty if not sent
+	BodySHA256 string `json:"bodySha256"` // hex encoded SHA-256 of the response body
+}
+
+// signedEnvelope returns the bytes signed for the response body
+func signedEnvelope(signedAt, appVersion, nonce string, body []byte) []byte {
+	envelope, _ := json.Marshal(&signatureEnvelope{
+		SignedAt:   signedAt,
+		AppVersion: appVersion,
+		Nonce:      nonce,
+		BodySHA256: fmt.Sprintf("%x", sha256.Sum256(body)),
+	})
+	return envelope
+}
+
+// loadSigningKey loads the Ed25519 private key in PKCS #8 PEM format, e.g. generated by
+// `openssl genpkey -algorithm ed25519 -out signing-key.pem`
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to read signing key file %v", path)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in signing key file %v", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to parse signing key file %v", path)
+	}
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key in %v is %T instead of an Ed25519 key", path, key)
+	}
+	return signingKey, nil
+}
+
+// signResponse returns the values of the signed at and signature headers of the response body to the request
+func signResponse(signingKey ed25519.PrivateKey, now time.Time, appVersion, nonce string, body []byte) (string, string) {
+	signedAt := now.UTC().Format(time.RFC3339)
+	signature := ed25519.Sign(signingKey, signedEnvelope(signedAt, appVersion, nonce, body))
+	return signedAt, base64.StdEncoding.EncodeToString(signature)
+}
@@ -0,0 +1,218 @@
+package upgraderesponder
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/longhorn/upgrade-responder/client"
+)
+
+func TestLoadSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	publicKey, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validPath := filepath.Join(dir, "signing-key.pem")
+	if err := os.WriteFile(validPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	invalidPath := filepath.Join(dir, "invalid.pem")
+	if err := os.WriteFile(invalidPath, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadSigningKey(validPath)
+	if err != nil {
+		t.Fatalf("failed to load signing key: %v", err)
+	}
+	if !loaded.Equal(signingKey) {
+		t.Errorf("loaded signing key not equal to the generated one")
+	}
+	if _, err := loadSigningKey(invalidPath); err == nil {
+		t.Errorf("expected error for invalid signing key file")
+	}
+	if _, err := loadSigningKey(filepath.Join(dir, "not-found.pem")); err == nil {
+		t.Errorf("expected error for missing signing key file")
+	}
+
+	// The clients pin the public key in PEM format
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := client.ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	if err != nil {
+		t.Fatalf("failed to parse public key: %v", err)
+	}
+	if !parsed.Equal(publicKey) {
+		t.Errorf("parsed public key not equal to the generated one")
+	}
+}
+
+func TestSignedResponseVerifiedByClient(t *testing.T) {
+	oldPublicKey, oldSigningKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPublicKey, newSigningKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var signingKey ed25519.PrivateKey
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		resp := &CheckUpgradeResponse{Versions: []ResponseVersion{{Version: Version{Name: "v1.0.0"}}}, RequestIntervalInMinutes: 60}
+		if err := respondWithJSONAndETag(rw, req, resp, signingKey, "v0.9.0"); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		signingKey    ed25519.PrivateKey
+		publicKeys    []ed25519.PublicKey
+		expectedError bool
+	}{
+		{signingKey: nil, publicKeys: nil, expectedError: false},
+		{signingKey: oldSigningKey, publicKeys: nil, expectedError: false},
+		{signingKey: oldSigningKey, publicKeys: []ed25519.PublicKey{oldPublicKey}, expectedError: false},
+		// both keys are valid during the rotation
+		{signingKey: oldSigningKey, publicKeys: []ed25519.PublicKey{oldPublicKey, newPublicKey}, expectedError: false},
+		{signingKey: newSigningKey, publicKeys: []ed25519.PublicKey{oldPublicKey, newPublicKey}, expectedError: false},
+		{signingKey: newSigningKey, publicKeys: []ed25519.PublicKey{oldPublicKey}, expectedError: true},
+		{signingKey: oldSigningKey, publicKeys: []ed25519.PublicKey{otherPublicKey}, expectedError: true},
+		{signingKey: nil, publicKeys: []ed25519.PublicKey{oldPublicKey}, expectedError: true},
+	}
+	for i, testCase := range testCases {
+		signingKey = testCase.signingKey
+		checker := client.NewUpgradeChecker(server.URL, nil)
+		checker.SetPublicKeys(testCase.publicKeys...)
+		resp, err := checker.CheckUpgrade("v0.9.0", nil)
+		if testCase.expectedError {
+			if !errors.Is(err, client.ErrInvalidSignature) {
+				t.Errorf("Test case %v: expected invalid signature error but got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test case %v: unexpected error %v", i, err)
+			continue
+		}
+		if len(resp.Versions) != 1 || resp.Versions[0].Name != "v1.0.0" {
+			t.Errorf("Test case %v: unexpected response %+v", i, resp)
+		}
+	}
+}
+
+func TestSignedResponseBoundToRequest(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	publicKey, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		signedFor string        // signs the response for this app version instead of the requested one if not empty
+		signedAgo time.Duration // how long before now the response is signed
+		replay    bool          // sends the recorded response instead of a new one
+		recorded  *httptest.ResponseRecorder
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !replay || recorded == nil {
+			checkReq := &CheckUpgradeRequest{}
+			if err := json.NewDecoder(req.Body).Decode(checkReq); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			appVersion := checkReq.AppVersion
+			if signedFor != "" {
+				appVersion = signedFor
+			}
+			timeNow = func() time.Time { return time.Now().Add(-signedAgo) }
+			resp := &CheckUpgradeResponse{Versions: []ResponseVersion{{Version: Version{Name: "v1.0.0"}}}, RequestIntervalInMinutes: 60}
+			recorded = httptest.NewRecorder()
+			if err := respondWithJSONAndETag(recorded, req, resp, signingKey, appVersion); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}
+		for key, values := range recorded.Header() {
+			rw.Header()[key] = values
+		}
+		rw.WriteHeader(recorded.Code)
+		_, _ = rw.Write(recorded.Body.Bytes())
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name          string
+		signedFor     string
+		signedAgo     time.Duration
+		replay        bool
+		expectedError bool
+	}{
+		{name: "fresh response", expectedError: false},
+		{name: "replayed response", replay: true, expectedError: true},
+		{name: "response signed for another app version", signedFor: "v0.8.0", expectedError: true},
+		{name: "response signed within the max age", signedAgo: 10 * time.Minute, expectedError: false},
+		{name: "stale response", signedAgo: 2 * time.Hour, expectedError: true},
+		{name: "response signed in the future", signedAgo: -2 * time.Hour, expectedError: true},
+	}
+	for i, testCase := range testCases {
+		checker := client.NewUpgradeChecker(server.URL, nil)
+		checker.SetPublicKeys(publicKey)
+		if testCase.replay {
+			// record a valid response to another request first
+			replay = false
+			if _, err := checker.CheckUpgrade("v0.9.0", nil); err != nil {
+				t.Fatalf("Test case %v: unexpected error %v", i, err)
+			}
+			checker = client.NewUpgradeChecker(server.URL, nil)
+			checker.SetPublicKeys(publicKey)
+		}
+		signedFor, signedAgo, replay = testCase.signedFor, testCase.signedAgo, testCase.replay
+		_, err := checker.CheckUpgrade("v0.9.0", nil)
+		if testCase.expectedError && !errors.Is(err, client.ErrInvalidSignature) {
+			t.Errorf("Test case %v: %v: expected invalid signature error but got %v", i, testCase.name, err)
+		}
+		if !testCase.expectedError && err != nil {
+			t.Errorf("Test case %v: %v: unexpected error %v", i, testCase.name, err)
+		}
+		signedFor, signedAgo, replay = "", 0, false
+	}
+
+	// A 304 Not Modified response is signed for the cached body and the new request
+	checker := client.NewUpgradeChecker(server.URL, nil)
+	checker.SetPublicKeys(publicKey)
+	if _, err := checker.CheckUpgrade("v0.9.0", nil); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := checker.CheckUpgrade("v0.9.0", nil)
+	if err != nil {
+		t.Fatalf("failed to verify the signed 304 response: %v", err)
+	}
+	if recorded.Code != http.StatusNotModified || len(resp.Versions) != 1 {
+		t.Errorf("expected the cached response on 304, got status %v and %+v", recorded.Code, resp)
+	}
+	signedAgo = 2 * time.Hour
+	if _, err := checker.CheckUpgrade("v0.9.0", nil); !errors.Is(err, client.ErrInvalidSignature) {
+		t.Errorf("expected invalid signature error for a stale 304 response but got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// SimulationResult is the response a hypothetical client request would receive
+type SimulationResult struct {
+	Request  CheckUpgradeRequest   `json:"request"`
+	Response *CheckUpgradeResponse `json:"response,omitempty"`
+	Error    string                `json:"error,omitempty"`
+}
+
+// NewSimulationServer loads the response config of the files, with its advisories if any, into a server which only
+// generates responses. The request schema is not loaded. It doesn't need the GeoDB nor InfluxDB and doesn't record
+// the requests.
+func NewSimulationServer(files ConfigFiles) (*Server, error) {
+	s := &Server{
+		VersionMap:     map[string]*Version{},
+		TagVersionsMap: map[string][]*Version{},
+		configFiles:    files,
+	}
+	if err := s.ReloadResponseConfig(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadSimulationRequests loads the JSON list of hypothetical client requests
+func LoadSimulationRequests(requestsFilePath string) ([]CheckUpgradeRequest, error) {
+	content, err := os.ReadFile(filepath.Clean(requestsFilePath))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to read requests file %v", requestsFilePath)
+	}
+	var requests []CheckUpgradeRequest
+	if err := json.Unmarshal(content, &requests); err != nil {
+		return nil, errors.Wrapf(err, "fail to decode requests file %v", requestsFilePath)
+	}
+	return requests, nil
+}
+
+// Simulate generates the response of each request the same way as the server does for the real clients
+func (s *Server) Simulate(requests []CheckUpgradeRequest) []SimulationResult {
+	results := make([]SimulationResult, len(requests))
+	for i := range requests {
+		results[i].Request = requests[i]
+		resp, err := s.GenerateCheckUpgradeResponse(&requests[i])
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Response = resp
+	}
+	return results
+}
@@ -0,0 +1,58 @@
+package upgraderesponder
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	dir := t.TempDir()
+	responseConfigFilePath := filepath.Join(dir, "response.json")
+	requestsFilePath := filepath.Join(dir, "requests.json")
+	if err := os.WriteFile(responseConfigFilePath, []byte(`{"versions": [
+		{"name": "v1.2.0", "releaseDate": "2022-03-17T00:00:00Z", "tags": ["v1.2.0"]},
+		{"name": "v1.3.0", "releaseDate": "2022-06-15T00:00:00Z", "tags": ["latest"], "constraints": {"kubernetesVersion": ">=1.21.0"}}
+	]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(requestsFilePath, []byte(`[
+		{"appVersion": "v1.1.0", "extraTagInfo": {"kubernetesVersion": "v1.25.0"}},
+		{"appVersion": "v1.1.0", "extraTagInfo": {"kubernetesVersion": "v1.20.0"}},
+		{"appVersion": "v1.3.0"}
+	]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSimulationServer(ConfigFiles{ResponseConfigFilePath: responseConfigFilePath})
+	if err != nil {
+		t.Fatalf("failed to create simulation server: %v", err)
+	}
+	requests, err := LoadSimulationRequests(requestsFilePath)
+	if err != nil {
+		t.Fatalf("failed to load requests: %v", err)
+	}
+	results := s.Simulate(requests)
+
+	expected := [][]string{{"v1.2.0", "v1.3.0"}, {"v1.2.0"}, {}}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %v results but got %v", len(expected), len(results))
+	}
+	for i, result := range results {
+		if result.Error != "" {
+			t.Fatalf("Test case %v: unexpected error %v", i, result.Error)
+		}
+		names := []string{}
+		for _, v := range result.Response.Versions {
+			names = append(names, v.Name)
+		}
+		sort.Strings(names)
+		if !equalStrings(names, expected[i]) {
+			t.Errorf("Test case %v: versions %v not equal to expected %v", i, names, expected[i])
+		}
+		if result.Request.AppVersion != requests[i].AppVersion {
+			t.Errorf("Test case %v: request %+v not equal to expected %+v", i, result.Request, requests[i])
+		}
+	}
+}
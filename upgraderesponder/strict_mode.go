@@ -0,0 +1,98 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/longhorn/upgrade-responder/utils"
+)
+
+const (
+	// StrictModeReport adds the violations of the request schema to the response
+	StrictModeReport = "report"
+	// StrictModeReject responds 422 with the violations of the request schema instead of the upgrade info
+	StrictModeReject = "reject"
+
+	ViolationRuleUnknownKey = "unknown key"
+)
+
+// Violation is a value of the request which is not stored because it doesn't satisfy the request schema
+type Violation struct {
+	Key   string      `json:"key"` // e.g. appVersion or extraTagInfo.kubernetesVersion
+	Value interface{} `json:"value"`
+	Rule  string      `json:"rule"` // the schema rule broken, e.g. "pattern ^v[0-9]+", or "unknown key"
+}
+
+// ViolationsResponse is the body of the response to a request rejected in the strict mode
+type ViolationsResponse struct {
+	Message    string      `json:"message"`
+	Violations []Violation `json:"violations"`
+}
+
+// ValidateStrictMode returns an error if the strict mode is neither empty nor supported
+func ValidateStrictMode(mode string) error {
+	switch mode {
+	case "", StrictModeReport, StrictModeReject:
+		return nil
+	}
+	return fmt.Errorf("unsupported strict mode %v, must be %v or %v", mode, StrictModeReport, StrictModeReject)
+}
+
+// validateRequest returns the values of the request which are dropped instead of being stored, sorted by key
+func (s *Server) validateRequest(req *CheckUpgradeRequest) []Violation {
+	s.RLock()
+	defer s.RUnlock()
+
+	var violations []Violation
+	if rule := s.RequestSchema.AppVersionSchema.violatedRule(req.AppVersion); rule != "" {
+		violations = append(violations, Violation{Key: "appVersion", Value: req.AppVersion, Rule: rule})
+	}
+	for _, extraTagInfo := range []struct {
+		name   string
+		values map[string]string
+	}{
+		{"extraInfo", req.ExtraInfo},
+		{"extraTagInfo", req.ExtraTagInfo},
+	} {
+		for _, key := range utils.SortedKeys(extraTagInfo.values) {
+			value := extraTagInfo.values[key]
+			if violation := violationOf(s.RequestSchema.ExtraTagInfoSchema, extraTagInfo.name, key, value); violation != nil {
+				violations = append(violations, *violation)
+			}
+		}
+	}
+	for _, key := range utils.SortedKeys(req.ExtraFieldInfo) {
+		value := req.ExtraFieldInfo[key]
+		if violation := violationOf(s.RequestSchema.ExtraFieldInfoSchema, "extraFieldInfo", key, value); violation != nil {
+			violations = append(violations, *violation)
+		}
+	}
+	return violations
+}
+
+// violationOf returns the violation of the value of the key by the schemas, or nil if the value is valid
+func violationOf(schemas map[string]Schema, name, key string, value interface{}) *Violation {
+	schema, ok := schemas[key]
+	if !ok {
+		return &Violation{Key: joinConfigPath(name, key), Value: value, Rule: ViolationRuleUnknownKey}
+	}
+	if rule := schema.violatedRule(schema.normalize(value)); rule != "" {
+		return &Violation{Key: joinConfigPath(name, key), Value: value, Rule: rule}
+	}
+	return nil
+}
+
+func respondWithViolations(rw http.ResponseWriter, violations []Violation) error {
+	response, err := json.Marshal(&ViolationsResponse{
+		Message:    fmt.Sprintf("%v value(s) of the request violate the request schema", len(violations)),
+		Violations: violations,
+	})
+	if err != nil {
+		return err
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusUnprocessableEntity)
+	_, err = rw.Write(response)
+	return err
+}
@@ -0,0 +1,139 @@
+package upgraderesponder
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	maxminddb "github.com/oschwald/maxminddb-golang"
+
+	"github.com/longhorn/upgrade-responder/client"
+)
+
+func newStrictModeTestServer(t *testing.T, strictMode string) *Server {
+	s := newTestServer(t, []Version{{Name: "v1.0.0", ReleaseDate: "2020-05-30T10:20:00Z", Tags: []string{"latest"}}})
+	s.db = &maxminddb.Reader{}
+	s.scarfService = NewScarfService("", 0)
+	s.strictMode = strictMode
+	if err := s.validateAndLoadRequestSchema(RequestSchema{
+		AppVersionSchema: Schema{DataType: "string", Pattern: "^v"},
+		ExtraTagInfoSchema: map[string]Schema{
+			"kubernetesVersion": {DataType: "string", Pattern: `^v[0-9]+\.[0-9]+`},
+		},
+		ExtraFieldInfoSchema: map[string]Schema{
+			"nodeCount": {DataType: "int", Min: floatPtr(1)},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStrictMode(t *testing.T) {
+	testCases := []struct {
+		strictMode         string
+		request            string
+		expectedCode       int
+		expectedViolations []Violation
+	}{
+		{
+			strictMode:   "",
+			request:      `{"appVersion": "0.9", "extraTagInfo": {"kubernetesVersion": "1.27"}}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			strictMode:   StrictModeReport,
+			request:      `{"appVersion": "v0.9.0", "extraTagInfo": {"kubernetesVersion": "v1.27.4"}, "extraFieldInfo": {"nodeCount": 3}}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			strictMode:   StrictModeReport,
+			request:      `{"appVersion": "0.9.0", "extraTagInfo": {"kubernetesVersion": "1.27.4", "arch": "amd64"}, "extraFieldInfo": {"nodeCount": 0.5}}`,
+			expectedCode: http.StatusOK,
+			expectedViolations: []Violation{
+				{Key: "appVersion", Value: "0.9.0", Rule: "pattern ^v"},
+				{Key: "extraTagInfo.arch", Value: "amd64", Rule: ViolationRuleUnknownKey},
+				{Key: "extraTagInfo.kubernetesVersion", Value: "1.27.4", Rule: `pattern ^v[0-9]+\.[0-9]+`},
+				{Key: "extraFieldInfo.nodeCount", Value: 0.5, Rule: "dataType int"},
+			},
+		},
+		{
+			strictMode:   StrictModeReject,
+			request:      `{"appVersion": "v0.9.0", "extraInfo": {"kubernetesVersion": "v1.27.4"}, "extraFieldInfo": {"nodeCount": 3}}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			strictMode:   StrictModeReject,
+			request:      `{"appVersion": "v0.9.0", "extraInfo": {"kubernetesVersion": "v1.27.4"}, "extraFieldInfo": {"nodeCount": 0}}`,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedViolations: []Violation{
+				{Key: "extraFieldInfo.nodeCount", Value: 0.0, Rule: "min 1"},
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+		s := newStrictModeTestServer(t, testCase.strictMode)
+		rw := httptest.NewRecorder()
+		s.CheckUpgrade(rw, httptest.NewRequest("POST", "/v1/checkupgrade", strings.NewReader(testCase.request)))
+		if rw.Code != testCase.expectedCode {
+			t.Errorf("Test case %v: responded %v: %v, expected %v", i, rw.Code, rw.Body.String(), testCase.expectedCode)
+			continue
+		}
+
+		var violations []Violation
+		if rw.Code == http.StatusOK {
+			var resp CheckUpgradeResponse
+			if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Versions) != 1 {
+				t.Errorf("Test case %v: the upgrade info is not responded: %+v", i, resp)
+			}
+			violations = resp.Violations
+		} else {
+			var resp ViolationsResponse
+			if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			violations = resp.Violations
+		}
+		if !reflect.DeepEqual(violations, testCase.expectedViolations) {
+			t.Errorf("Test case %v: violations are %+v, expected %+v", i, violations, testCase.expectedViolations)
+		}
+	}
+}
+
+func TestStrictModeViolationsInClient(t *testing.T) {
+	var s *Server
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		s.CheckUpgrade(rw, req)
+	}))
+	defer server.Close()
+
+	extraInfo := map[string]string{"kubernetesVersion": "1.27.4"}
+
+	s = newStrictModeTestServer(t, StrictModeReport)
+	resp, err := client.NewUpgradeChecker(server.URL, nil).CheckUpgrade("v0.9.0", extraInfo)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []client.Violation{{Key: "extraInfo.kubernetesVersion", Value: "1.27.4", Rule: `pattern ^v[0-9]+\.[0-9]+`}}
+	if !reflect.DeepEqual(resp.Violations, expected) {
+		t.Errorf("violations are %+v, expected %+v", resp.Violations, expected)
+	}
+
+	s = newStrictModeTestServer(t, StrictModeReject)
+	_, err = client.NewUpgradeChecker(server.URL, nil).CheckUpgrade("v0.9.0", extraInfo)
+	var violationsErr *client.ViolationsError
+	if !errors.As(err, &violationsErr) {
+		t.Fatalf("expected violations error but got %v", err)
+	}
+	if !reflect.DeepEqual(violationsErr.Violations, expected) {
+		t.Errorf("violations are %+v, expected %+v", violationsErr.Violations, expected)
+	}
+}
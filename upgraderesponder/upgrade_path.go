@@ -0,0 +1,105 @@
+package upgraderesponder
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+)
+
+const VersionTagStable = "stable"
+
+// upgradeNode is a version in the upgrade graph. There is an edge from node u to node v
+// if v is newer than u and u satisfies the minUpgradableVersion of v.
+type upgradeNode struct {
+	version       *Version
+	semver        *semver.Version
+	minUpgradable *semver.Version // nil if v can be upgraded from any older version
+
+	hops int          // number of upgrades needed to reach this node, 0 if unreachable
+	prev *upgradeNode // the previous hop, nil if reachable directly from the starting version
+}
+
+func (n *upgradeNode) upgradableFrom(v *semver.Version) bool {
+	return n.semver.GreaterThan(v) && (n.minUpgradable == nil || !v.LessThan(n.minUpgradable))
+}
+
+// preferredOver decides which of two equally short paths to take: prefer the `stable` tag then the newest version
+func (n *upgradeNode) preferredOver(o *upgradeNode) bool {
+	nStable, oStable := hasTag(n.version, VersionTagStable), hasTag(o.version, VersionTagStable)
+	if nStable != oStable {
+		return nStable
+	}
+	return n.semver.GreaterThan(o.semver)
+}
+
+// findUpgradePath returns the shortest ordered list of versions to install one after another to upgrade from
+// the version from to the version target. The starting version is not part of the path. Intermediate hops are
+// only taken from versions.
+func findUpgradePath(versions []*Version, from *semver.Version, target *Version) ([]*Version, error) {
+	targetVer, err := semver.NewVersion(target.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !targetVer.GreaterThan(from) {
+		return nil, fmt.Errorf("target version %v is not newer than %v", target.Name, from.Original())
+	}
+
+	nodes := []*upgradeNode{}
+	var targetNode *upgradeNode
+	for _, v := range versions {
+		ver, err := semver.NewVersion(v.Name)
+		if err != nil {
+			return nil, err
+		}
+		// Downgrades are never part of an upgrade path so only the versions in (from, target] matter
+		if !ver.GreaterThan(from) || ver.GreaterThan(targetVer) {
+			continue
+		}
+		n := &upgradeNode{version: v, semver: ver}
+		if v.MinUpgradableVersion != "" {
+			if n.minUpgradable, err = semver.NewVersion(v.MinUpgradableVersion); err != nil {
+				return nil, errors.Wrapf(err, "invalid minUpgradableVersion of version %v", v.Name)
+			}
+		}
+		if v.Name == target.Name {
+			targetNode = n
+		}
+		nodes = append(nodes, n)
+	}
+	if targetNode == nil {
+		return nil, fmt.Errorf("target version %v is not in the version list", target.Name)
+	}
+
+	// Every edge goes to a strictly newer version, so visiting the nodes in ascending order visits
+	// all predecessors of a node before the node itself. Even a config with minUpgradableVersions
+	// referencing each other cannot make the graph cyclic.
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].semver.LessThan(nodes[j].semver)
+	})
+	for i, n := range nodes {
+		if n.upgradableFrom(from) {
+			n.hops = 1
+			continue
+		}
+		for _, p := range nodes[:i] {
+			if p.hops == 0 || !n.upgradableFrom(p.semver) {
+				continue
+			}
+			if n.hops == 0 || p.hops+1 < n.hops || (p.hops+1 == n.hops && p.preferredOver(n.prev)) {
+				n.hops = p.hops + 1
+				n.prev = p
+			}
+		}
+	}
+
+	if targetNode.hops == 0 {
+		return nil, fmt.Errorf("no upgrade path from %v to %v", from.Original(), target.Name)
+	}
+	path := make([]*Version, targetNode.hops)
+	for n, i := targetNode, targetNode.hops-1; n != nil; n, i = n.prev, i-1 {
+		path[i] = n.version
+	}
+	return path, nil
+}
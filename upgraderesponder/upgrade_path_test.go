@@ -0,0 +1,145 @@
+package upgraderesponder
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver"
+)
+
+func TestFindUpgradePath(t *testing.T) {
+	testCases := []struct {
+		versions      []Version
+		from          string
+		target        string
+		expectedPath  []string
+		expectedError bool
+	}{
+		{
+			// directly upgradable
+			versions: []Version{
+				{Name: "v1.2.4", Tags: []string{"stable"}},
+				{Name: "v1.3.0", Tags: []string{"latest"}},
+			},
+			from:         "v1.2.0",
+			target:       "v1.3.0",
+			expectedPath: []string{"v1.3.0"},
+		},
+		{
+			versions: []Version{
+				{Name: "v1.1.3", Tags: []string{"stable"}},
+				{Name: "v1.2.4", MinUpgradableVersion: "v1.1.0", Tags: []string{"stable"}},
+				{Name: "v1.3.0", MinUpgradableVersion: "v1.2.0", Tags: []string{"latest"}},
+			},
+			from:         "v1.1.3",
+			target:       "v1.3.0",
+			expectedPath: []string{"v1.2.4", "v1.3.0"},
+		},
+		{
+			versions: []Version{
+				{Name: "v1.1.3", Tags: []string{"stable"}},
+				{Name: "v1.2.4", MinUpgradableVersion: "v1.1.0", Tags: []string{"stable"}},
+				{Name: "v1.3.0", MinUpgradableVersion: "v1.2.0", Tags: []string{"latest"}},
+			},
+			from:         "v1.0.0",
+			target:       "v1.3.0",
+			expectedPath: []string{"v1.1.3", "v1.2.4", "v1.3.0"},
+		},
+		{
+			// prefer the stable version between equally short paths
+			versions: []Version{
+				{Name: "v1.2.4", MinUpgradableVersion: "v1.1.0", Tags: []string{"stable"}},
+				{Name: "v1.2.5", MinUpgradableVersion: "v1.1.0", Tags: []string{"dev"}},
+				{Name: "v1.3.0", MinUpgradableVersion: "v1.2.0", Tags: []string{"latest"}},
+			},
+			from:         "v1.1.3",
+			target:       "v1.3.0",
+			expectedPath: []string{"v1.2.4", "v1.3.0"},
+		},
+		{
+			// then prefer the newest patch
+			versions: []Version{
+				{Name: "v1.2.3", MinUpgradableVersion: "v1.1.0", Tags: []string{"stable"}},
+				{Name: "v1.2.5", MinUpgradableVersion: "v1.1.0", Tags: []string{"stable"}},
+				{Name: "v1.2.4", MinUpgradableVersion: "v1.1.0", Tags: []string{"stable"}},
+				{Name: "v1.3.0", MinUpgradableVersion: "v1.2.0", Tags: []string{"latest"}},
+			},
+			from:         "v1.1.3",
+			target:       "v1.3.0",
+			expectedPath: []string{"v1.2.5", "v1.3.0"},
+		},
+		{
+			// prefer the shortest path over the stable tag
+			versions: []Version{
+				{Name: "v1.2.0", MinUpgradableVersion: "v1.1.0", Tags: []string{"stable"}},
+				{Name: "v1.2.5", MinUpgradableVersion: "v1.2.0", Tags: []string{"stable"}},
+				{Name: "v1.3.0", MinUpgradableVersion: "v1.2.5", Tags: []string{"dev"}},
+				{Name: "v1.4.0", MinUpgradableVersion: "v1.2.5", Tags: []string{"latest"}},
+			},
+			from:         "v1.1.0",
+			target:       "v1.4.0",
+			expectedPath: []string{"v1.2.0", "v1.2.5", "v1.4.0"},
+		},
+		{
+			// unreachable version
+			versions: []Version{
+				{Name: "v1.2.4", MinUpgradableVersion: "v1.2.0", Tags: []string{"stable"}},
+				{Name: "v1.3.0", MinUpgradableVersion: "v1.2.0", Tags: []string{"latest"}},
+			},
+			from:          "v1.1.3",
+			target:        "v1.3.0",
+			expectedError: true,
+		},
+		{
+			// versions requiring each other in a bad config must not loop forever
+			versions: []Version{
+				{Name: "v1.2.0", MinUpgradableVersion: "v1.3.0", Tags: []string{"stable"}},
+				{Name: "v1.3.0", MinUpgradableVersion: "v1.2.0", Tags: []string{"latest"}},
+			},
+			from:          "v1.1.0",
+			target:        "v1.3.0",
+			expectedError: true,
+		},
+		{
+			// a version requiring itself
+			versions: []Version{
+				{Name: "v1.3.0", MinUpgradableVersion: "v1.3.0", Tags: []string{"latest"}},
+			},
+			from:          "v1.2.0",
+			target:        "v1.3.0",
+			expectedError: true,
+		},
+		{
+			// downgrade
+			versions: []Version{
+				{Name: "v1.3.0", Tags: []string{"latest"}},
+			},
+			from:          "v1.4.0",
+			target:        "v1.3.0",
+			expectedError: true,
+		},
+	}
+
+	for i, testCase := range testCases {
+		versions := []*Version{}
+		var target *Version
+		for j := range testCase.versions {
+			versions = append(versions, &testCase.versions[j])
+			if testCase.versions[j].Name == testCase.target {
+				target = &testCase.versions[j]
+			}
+		}
+
+		path, err := findUpgradePath(versions, semver.MustParse(testCase.from), target)
+		if testCase.expectedError != (err != nil) {
+			t.Errorf("Test case %v: expected error %v but got %v", i, testCase.expectedError, err)
+			continue
+		}
+		names := []string{}
+		for _, v := range path {
+			names = append(names, v.Name)
+		}
+		if !testCase.expectedError && !equalStrings(names, testCase.expectedPath) {
+			t.Errorf("Test case %v: path %v not equal to expected %v", i, names, testCase.expectedPath)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -35,3 +36,23 @@ func MergeStringMaps(maps ...map[string]string) map[string]string {
 	}
 	return result
 }
+
+// Contains returns whether the slice contains the string s.
+func Contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SortedKeys returns the keys of the map in ascending order.
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}